@@ -0,0 +1,50 @@
+// Command lobby lists networked battles and hosts their game servers on
+// this machine. Players browse it from the game with `tanks3d --lobby`.
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"time"
+
+	"tanks3d/internal/matchflags"
+	"tanks3d/lobby"
+)
+
+func main() {
+	addr := flag.String("addr", "localhost:8080", "HTTP address to serve the lobby on")
+	host := flag.String("host", "127.0.0.1", "address game servers listen on, for players to connect to")
+	mapsDir := flag.String("maps", "data/maps", "directory of map files battles can be fought on")
+	maxBattles := flag.Int("max-battles", lobby.DefaultMaxBattles, "most battles hosted at once")
+	idleTimeout := flag.Duration("idle-timeout", lobby.DefaultIdleTimeout, "close battles nobody has been connected to for this long (0 for never)")
+
+	// Battles pick their own mode, difficulty and map
+	match := matchflags.Register(flag.CommandLine, matchflags.Rewind, "7v7")
+	flag.Parse()
+
+	cfg, classes, err := match.Config()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	service := lobby.New(cfg, classes, *mapsDir, *host)
+	service.Logf = log.Printf
+	service.MaxBattles = *maxBattles
+	service.IdleTimeout = *idleTimeout
+
+	// Requests are small JSON bodies; don't let slow or idle connections
+	// hold on to the lobby
+	server := &http.Server{
+		Addr:              *addr,
+		Handler:           service,
+		ReadHeaderTimeout: 5 * time.Second,
+		ReadTimeout:       10 * time.Second,
+		WriteTimeout:      10 * time.Second,
+		IdleTimeout:       time.Minute,
+	}
+	log.Printf("lobby open on http://%s", *addr)
+	if err := server.ListenAndServe(); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,41 @@
+// Command tankserver hosts a networked match. Every tank starts under AI
+// control and players take them over by connecting with `tanks3d --connect`.
+package main
+
+import (
+	"flag"
+	"log"
+
+	"tanks3d/internal/matchflags"
+	"tanks3d/netplay"
+)
+
+func main() {
+	addr := flag.String("addr", ":7777", "UDP address to listen on")
+	match := matchflags.Register(flag.CommandLine, matchflags.Battle|matchflags.Rewind, "7v7")
+	var network netplay.Conditions
+	flag.DurationVar(&network.Latency, "lag", 0, "delay every packet each way by this much to test prediction")
+	flag.DurationVar(&network.Jitter, "jitter", 0, "add up to this much random delay to every packet")
+	flag.Float64Var(&network.Loss, "loss", 0, "drop this share of packets (0 to 1)")
+	flag.Parse()
+
+	cfg, classes, err := match.Config()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	server, err := netplay.Listen(*addr, cfg, classes, network)
+	if err != nil {
+		log.Fatal(err)
+	}
+	server.Logf = log.Printf
+
+	log.Printf("serving a %s match on %s (seed %d); waiting for players", cfg.Mode, server.Addr(), cfg.Seed)
+	if !network.Ideal() {
+		log.Printf("simulating %v", network)
+	}
+	if err := server.Run(); err != nil {
+		log.Fatal(err)
+	}
+	log.Print("match over")
+}
@@ -0,0 +1,570 @@
+package game3d
+
+import (
+	"fmt"
+	"math"
+
+	"tanks3d/sim"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+const (
+	editorMoveSpeed   = 30    // Units per second, tripled with Shift
+	editorLookSpeed   = 0.004 // Radians per pixel of mouse movement
+	editorRotateStep  = 15    // Degrees per press of R
+	editorPickRange   = 500   // Farthest the cursor reaches
+	editorSpawnRadius = 2.5   // How close a click has to be to a spawn point
+	editorMaxUndo     = 100
+)
+
+// editorTool is what a click on empty ground places.
+type editorTool struct {
+	name  string
+	place func(m *sim.Map, at sim.Vec3) selection
+}
+
+var editorTools = []editorTool{
+	{"Building", func(m *sim.Map, at sim.Vec3) selection {
+		return placeObstacle(m, sim.Obstacle{Position: at, Size: sim.NewVec3(5, 3, 5), Type: "building"})
+	}},
+	{"Tree", func(m *sim.Map, at sim.Vec3) selection {
+		return placeObstacle(m, sim.Obstacle{Position: at, Size: sim.NewVec3(1, 4, 1), Type: "tree"})
+	}},
+	{"Player spawn", func(m *sim.Map, at sim.Vec3) selection { return placeSpawn(m, sim.PlayerTeam, at) }},
+	{"Enemy spawn", func(m *sim.Map, at sim.Vec3) selection { return placeSpawn(m, sim.EnemyTeam, at) }},
+	{"Player base", func(m *sim.Map, at sim.Vec3) selection { return placeZone(m, sim.PlayerTeam, at) }},
+	{"Enemy base", func(m *sim.Map, at sim.Vec3) selection { return placeZone(m, sim.EnemyTeam, at) }},
+}
+
+func placeObstacle(m *sim.Map, o sim.Obstacle) selection {
+	m.Obstacles = append(m.Obstacles, o)
+	return selection{kind: selectObstacle, index: len(m.Obstacles) - 1}
+}
+
+func placeSpawn(m *sim.Map, team sim.Team, at sim.Vec3) selection {
+	m.Spawns[team] = append(m.Spawns[team], at)
+	return selection{kind: selectSpawn, team: team, index: len(m.Spawns[team]) - 1}
+}
+
+func placeZone(m *sim.Map, team sim.Team, at sim.Vec3) selection {
+	m.Zones = append(m.Zones, sim.CaptureZone{Team: team, Center: at, Radius: sim.CaptureRadius})
+	return selection{kind: selectZone, index: len(m.Zones) - 1}
+}
+
+type selectionKind int
+
+const (
+	selectNone selectionKind = iota
+	selectObstacle
+	selectSpawn
+	selectZone
+)
+
+// selection points at one thing on the map being edited.
+type selection struct {
+	kind  selectionKind
+	team  sim.Team // Spawn points only
+	index int
+}
+
+// mapSnapshot is everything an edit can change, for undo and redo.
+type mapSnapshot struct {
+	obstacles []sim.Obstacle
+	spawns    map[sim.Team][]sim.Vec3
+	zones     []sim.CaptureZone
+	selected  selection
+}
+
+// Editor is the map editor scene: a free camera over a map's terrain for
+// placing, moving, turning, resizing and deleting obstacles, spawn points
+// and bases, saved back to the map file.
+type Editor struct {
+	path    string
+	m       *sim.Map
+	terrain *sim.Terrain // Built from m after every edit
+	ground  ground
+
+	camera     rl.Camera3D
+	yaw, pitch float32
+
+	tool     int
+	selected selection
+	cursor   sim.Vec3 // Ground under the mouse
+	onGround bool     // Whether the mouse is over the map at all
+
+	dragging   bool
+	dragMoved  bool
+	dragOffset sim.Vec3
+
+	undo, redo []mapSnapshot
+	modified   bool
+
+	status      string
+	statusUntil float64
+}
+
+// NewEditor opens m for editing; saving writes it to path.
+func NewEditor(path string, m *sim.Map) *Editor {
+	e := &Editor{
+		path:  path,
+		m:     m,
+		yaw:   0,
+		pitch: -0.6,
+		camera: rl.Camera3D{
+			Position:   rl.NewVector3(0, 40, -m.Size),
+			Up:         rl.NewVector3(0, 1, 0),
+			Fovy:       60,
+			Projection: rl.CameraPerspective,
+		},
+	}
+	e.rebuild()
+	e.ground = loadGround(e.terrain, m.Environment)
+	e.look()
+	return e
+}
+
+// unload frees the ground mesh once the App drops the editor.
+func (e *Editor) unload() {
+	e.ground.unload()
+}
+
+// rebuild refreshes the terrain after an edit, settling obstacles onto the
+// ground again.
+func (e *Editor) rebuild() {
+	e.terrain = e.m.Terrain()
+}
+
+func (e *Editor) Update(app *App) {
+	if rl.IsCursorHidden() {
+		rl.EnableCursor()
+	}
+	if rl.IsKeyPressed(rl.KeyEscape) {
+		app.push(newEditorMenu(e))
+		return
+	}
+
+	ctrl := rl.IsKeyDown(rl.KeyLeftControl) || rl.IsKeyDown(rl.KeyRightControl)
+	shift := rl.IsKeyDown(rl.KeyLeftShift) || rl.IsKeyDown(rl.KeyRightShift)
+	switch {
+	case ctrl && rl.IsKeyPressed(rl.KeyS):
+		e.save()
+	case ctrl && (rl.IsKeyPressed(rl.KeyY) || shift && rl.IsKeyPressed(rl.KeyZ)):
+		e.step(&e.redo, &e.undo)
+	case ctrl && rl.IsKeyPressed(rl.KeyZ):
+		e.step(&e.undo, &e.redo)
+	}
+	if !ctrl {
+		e.fly(shift)
+	}
+
+	for i := range editorTools {
+		if rl.IsKeyPressed(rl.KeyOne + int32(i)) {
+			e.tool = i
+		}
+	}
+
+	e.cursor, e.onGround = e.groundUnderMouse()
+	e.handleMouse()
+	e.handleKeys(shift)
+}
+
+// fly moves the camera with WASD, Q and E, and turns it while the right
+// mouse button is held.
+func (e *Editor) fly(fast bool) {
+	if rl.IsMouseButtonDown(rl.MouseRightButton) {
+		delta := rl.GetMouseDelta()
+		e.yaw -= delta.X * editorLookSpeed
+		e.pitch = rl.Clamp(e.pitch-delta.Y*editorLookSpeed, -1.5, 1.5)
+	}
+
+	speed := editorMoveSpeed * rl.GetFrameTime()
+	if fast {
+		speed *= 3
+	}
+	sin, cos := float32(math.Sin(float64(e.yaw))), float32(math.Cos(float64(e.yaw)))
+	forward := rl.NewVector3(sin, 0, cos)
+	right := rl.NewVector3(-cos, 0, sin)
+
+	move := rl.Vector3{}
+	if rl.IsKeyDown(rl.KeyW) {
+		move = rl.Vector3Add(move, forward)
+	}
+	if rl.IsKeyDown(rl.KeyS) {
+		move = rl.Vector3Subtract(move, forward)
+	}
+	if rl.IsKeyDown(rl.KeyD) {
+		move = rl.Vector3Add(move, right)
+	}
+	if rl.IsKeyDown(rl.KeyA) {
+		move = rl.Vector3Subtract(move, right)
+	}
+	if rl.IsKeyDown(rl.KeyE) {
+		move.Y++
+	}
+	if rl.IsKeyDown(rl.KeyQ) {
+		move.Y--
+	}
+	e.camera.Position = rl.Vector3Add(e.camera.Position, rl.Vector3Scale(move, speed))
+
+	// Keep out of the ground
+	position := &e.camera.Position
+	if floor := e.terrain.HeightAt(position.X, position.Z) + 1; position.Y < floor {
+		position.Y = floor
+	}
+	e.look()
+}
+
+// look points the camera along its yaw and pitch.
+func (e *Editor) look() {
+	cosPitch := float32(math.Cos(float64(e.pitch)))
+	direction := rl.NewVector3(
+		float32(math.Sin(float64(e.yaw)))*cosPitch,
+		float32(math.Sin(float64(e.pitch))),
+		float32(math.Cos(float64(e.yaw)))*cosPitch,
+	)
+	e.camera.Target = rl.Vector3Add(e.camera.Position, direction)
+}
+
+// mouseRay returns the segment from the camera out through the cursor.
+func (e *Editor) mouseRay() (from, to sim.Vec3) {
+	ray := rl.GetMouseRay(rl.GetMousePosition(), e.camera)
+	from = sim.NewVec3(ray.Position.X, ray.Position.Y, ray.Position.Z)
+	to = from.Add(sim.NewVec3(ray.Direction.X, ray.Direction.Y, ray.Direction.Z).Scale(editorPickRange))
+	return from, to
+}
+
+// groundUnderMouse returns where the cursor meets the ground, ignoring
+// obstacles so one can be dragged over the others.
+func (e *Editor) groundUnderMouse() (sim.Vec3, bool) {
+	from, to := e.mouseRay()
+	bare := &sim.Terrain{Size: e.terrain.Size, Ground: e.terrain.Ground}
+	hit, ok := bare.SegmentHit(from, to)
+	if !ok || !bare.Contains(hit) {
+		return sim.Vec3{}, false
+	}
+	return hit, true
+}
+
+// pick returns what is under the cursor: the nearest obstacle in front of
+// the ground, then a spawn point or the middle or edge of a base.
+func (e *Editor) pick() selection {
+	from, to := e.mouseRay()
+	nearest := float32(2)
+	if e.onGround {
+		nearest = rl.Vector3Distance(vec3(from), vec3(e.cursor)) / rl.Vector3Distance(vec3(from), vec3(to))
+	}
+	picked := selection{}
+	for i, obstacle := range e.terrain.Obstacles {
+		if fraction, hit := obstacle.SegmentHit(from, to); hit && fraction <= nearest {
+			nearest = fraction
+			picked = selection{kind: selectObstacle, index: i}
+		}
+	}
+	if picked.kind != selectNone || !e.onGround {
+		return picked
+	}
+
+	for _, team := range []sim.Team{sim.PlayerTeam, sim.EnemyTeam} {
+		for i, spawn := range e.m.Spawns[team] {
+			if groundDistance(spawn, e.cursor) <= editorSpawnRadius {
+				return selection{kind: selectSpawn, team: team, index: i}
+			}
+		}
+	}
+	for i, zone := range e.m.Zones {
+		d := groundDistance(zone.Center, e.cursor)
+		if d <= 2 || float32(math.Abs(float64(d-zone.Radius))) <= 1.5 {
+			return selection{kind: selectZone, index: i}
+		}
+	}
+	return picked
+}
+
+// groundDistance is the distance between two points seen from above.
+func groundDistance(a, b sim.Vec3) float32 {
+	return float32(math.Hypot(float64(a.X-b.X), float64(a.Z-b.Z)))
+}
+
+// handleMouse selects with a left click, drags the selection while the
+// button is held, and places the current tool's item on empty ground.
+func (e *Editor) handleMouse() {
+	if rl.IsMouseButtonPressed(rl.MouseLeftButton) {
+		if picked := e.pick(); picked.kind != selectNone {
+			e.selected = picked
+			e.dragging, e.dragMoved = true, false
+			e.dragOffset = e.position(picked).Sub(e.cursor)
+			e.dragOffset.Y = 0
+		} else if e.onGround {
+			e.edit()
+			e.selected = editorTools[e.tool].place(e.m, sim.NewVec3(e.cursor.X, 0, e.cursor.Z))
+			e.rebuild()
+		} else {
+			e.selected = selection{}
+		}
+	}
+
+	if !rl.IsMouseButtonDown(rl.MouseLeftButton) {
+		e.dragging = false
+		return
+	}
+	if !e.dragging || !e.onGround || rl.GetMouseDelta() == (rl.Vector2{}) {
+		return
+	}
+	if !e.dragMoved {
+		// The whole drag is one step to undo
+		e.edit()
+		e.dragMoved = true
+	}
+	target := e.cursor.Add(e.dragOffset)
+	target.X = rl.Clamp(target.X, -e.m.Size, e.m.Size)
+	target.Z = rl.Clamp(target.Z, -e.m.Size, e.m.Size)
+	e.setPosition(e.selected, sim.NewVec3(target.X, 0, target.Z))
+	e.rebuild()
+}
+
+// handleKeys turns, resizes and deletes the selection.
+func (e *Editor) handleKeys(shift bool) {
+	if e.selected.kind == selectNone {
+		return
+	}
+
+	if rl.IsKeyPressed(rl.KeyR) && e.selected.kind == selectObstacle {
+		step := float32(editorRotateStep) * rl.Deg2rad
+		if shift {
+			step = -step
+		}
+		e.edit()
+		e.m.Obstacles[e.selected.index].Rotation += step
+		e.rebuild()
+	}
+
+	// The wheel resizes obstacles, or raises them with Shift, and widens
+	// bases
+	if wheel := rl.GetMouseWheelMove(); wheel != 0 && !rl.IsMouseButtonDown(rl.MouseRightButton) {
+		scale := float32(math.Pow(1.1, float64(wheel)))
+		switch e.selected.kind {
+		case selectObstacle:
+			e.edit()
+			size := &e.m.Obstacles[e.selected.index].Size
+			if shift {
+				size.Y *= scale
+			} else {
+				size.X *= scale
+				size.Z *= scale
+			}
+			e.rebuild()
+		case selectZone:
+			e.edit()
+			zone := &e.m.Zones[e.selected.index]
+			zone.Radius = rl.Clamp(zone.Radius*scale, 2, e.m.Size)
+		}
+	}
+
+	if rl.IsKeyPressed(rl.KeyDelete) || rl.IsKeyPressed(rl.KeyBackspace) {
+		e.delete(e.selected)
+	}
+}
+
+func (e *Editor) delete(s selection) {
+	switch s.kind {
+	case selectObstacle:
+		e.edit()
+		e.m.Obstacles = append(e.m.Obstacles[:s.index], e.m.Obstacles[s.index+1:]...)
+	case selectSpawn:
+		spawns := e.m.Spawns[s.team]
+		if len(spawns) == 1 {
+			e.notify(fmt.Sprintf("The %s team needs a spawn point", s.team))
+			return
+		}
+		e.edit()
+		e.m.Spawns[s.team] = append(spawns[:s.index], spawns[s.index+1:]...)
+	case selectZone:
+		e.edit()
+		e.m.Zones = append(e.m.Zones[:s.index], e.m.Zones[s.index+1:]...)
+	}
+	e.selected = selection{}
+	e.rebuild()
+}
+
+// position returns where a selected item stands.
+func (e *Editor) position(s selection) sim.Vec3 {
+	switch s.kind {
+	case selectObstacle:
+		return e.m.Obstacles[s.index].Position
+	case selectSpawn:
+		return e.m.Spawns[s.team][s.index]
+	case selectZone:
+		return e.m.Zones[s.index].Center
+	}
+	return sim.Vec3{}
+}
+
+func (e *Editor) setPosition(s selection, p sim.Vec3) {
+	switch s.kind {
+	case selectObstacle:
+		e.m.Obstacles[s.index].Position = p
+	case selectSpawn:
+		e.m.Spawns[s.team][s.index] = p
+	case selectZone:
+		e.m.Zones[s.index].Center = p
+	}
+}
+
+// edit records the map as it is before a change, for undo. Anything
+// undone since is lost.
+func (e *Editor) edit() {
+	e.undo = append(e.undo, e.snapshot())
+	if len(e.undo) > editorMaxUndo {
+		e.undo = e.undo[1:]
+	}
+	e.redo = nil
+	e.modified = true
+}
+
+// step restores the latest snapshot from one history and records the
+// current map in the other: undo from undo into redo, or the reverse.
+func (e *Editor) step(from, to *[]mapSnapshot) {
+	if len(*from) == 0 {
+		return
+	}
+	*to = append(*to, e.snapshot())
+	e.restore((*from)[len(*from)-1])
+	*from = (*from)[:len(*from)-1]
+	e.modified = true
+	e.dragging = false
+}
+
+func (e *Editor) snapshot() mapSnapshot {
+	s := mapSnapshot{
+		obstacles: append([]sim.Obstacle(nil), e.m.Obstacles...),
+		spawns:    make(map[sim.Team][]sim.Vec3),
+		zones:     append([]sim.CaptureZone(nil), e.m.Zones...),
+		selected:  e.selected,
+	}
+	for team, points := range e.m.Spawns {
+		s.spawns[team] = append([]sim.Vec3(nil), points...)
+	}
+	return s
+}
+
+func (e *Editor) restore(s mapSnapshot) {
+	e.m.Obstacles = s.obstacles
+	e.m.Spawns = s.spawns
+	e.m.Zones = s.zones
+	e.selected = s.selected
+	e.rebuild()
+}
+
+func (e *Editor) save() {
+	if err := sim.SaveMap(e.path, e.m); err != nil {
+		e.notify(fmt.Sprintf("Not saved: %v", err))
+		return
+	}
+	e.modified = false
+	e.notify("Saved " + e.path)
+}
+
+// notify shows a message at the bottom of the screen for a few seconds.
+func (e *Editor) notify(message string) {
+	e.status = message
+	e.statusUntil = rl.GetTime() + 4
+}
+
+func (e *Editor) Draw() {
+	rl.ClearBackground(rgba(e.m.Environment.Sky))
+	rl.BeginMode3D(e.camera)
+
+	drawTerrain(e.terrain, e.ground)
+	for i := range e.m.Zones {
+		drawZone(e.terrain, &e.m.Zones[i], e.m.Zones[i].Team == sim.PlayerTeam)
+	}
+	for _, team := range []sim.Team{sim.PlayerTeam, sim.EnemyTeam} {
+		for _, spawn := range e.m.Spawns[team] {
+			e.drawSpawn(spawn, team)
+		}
+	}
+	e.drawSelection()
+
+	if e.onGround {
+		rl.DrawCircle3D(rl.NewVector3(e.cursor.X, e.cursor.Y+0.05, e.cursor.Z), 0.5, rl.NewVector3(1, 0, 0), 90, rl.White)
+	}
+
+	rl.EndMode3D()
+
+	e.drawUI()
+}
+
+// drawSpawn marks a spawn point with a post in its team's color.
+func (e *Editor) drawSpawn(spawn sim.Vec3, team sim.Team) {
+	color := rl.Red
+	if team == sim.PlayerTeam {
+		color = rl.Blue
+	}
+	base := rl.NewVector3(spawn.X, e.terrain.HeightAt(spawn.X, spawn.Z), spawn.Z)
+	rl.DrawCylinder(base, 0.3, 0.3, 4, 8, color)
+	rl.DrawCylinder(base, editorSpawnRadius, editorSpawnRadius, 0.05, 16, rl.Fade(color, 0.5))
+}
+
+// drawSelection outlines the selected item in yellow.
+func (e *Editor) drawSelection() {
+	s := e.selected
+	switch s.kind {
+	case selectObstacle:
+		obstacle := e.terrain.Obstacles[s.index]
+		rl.PushMatrix()
+		rl.Translatef(obstacle.Position.X, obstacle.Position.Y, obstacle.Position.Z)
+		rl.Rotatef(obstacle.Rotation*rl.Rad2deg, 0, 1, 0)
+		rl.DrawCubeWiresV(rl.NewVector3(0, obstacle.Size.Y/2, 0), rl.Vector3AddValue(vec3(obstacle.Size), 0.2), rl.Yellow)
+		rl.PopMatrix()
+	case selectSpawn:
+		spawn := e.m.Spawns[s.team][s.index]
+		base := rl.NewVector3(spawn.X, e.terrain.HeightAt(spawn.X, spawn.Z)+0.1, spawn.Z)
+		rl.DrawCircle3D(base, editorSpawnRadius+0.3, rl.NewVector3(1, 0, 0), 90, rl.Yellow)
+	case selectZone:
+		zone := e.m.Zones[s.index]
+		center := rl.NewVector3(zone.Center.X, e.terrain.HeightAt(zone.Center.X, zone.Center.Z)+0.1, zone.Center.Z)
+		rl.DrawCircle3D(center, zone.Radius+0.5, rl.NewVector3(1, 0, 0), 90, rl.Yellow)
+		rl.DrawCircle3D(center, 2, rl.NewVector3(1, 0, 0), 90, rl.Yellow)
+	}
+}
+
+func (e *Editor) drawUI() {
+	title := fmt.Sprintf("MAP EDITOR - %s", e.path)
+	if e.modified {
+		title += " *"
+	}
+	rl.DrawText(title, 10, 10, 20, rl.Black)
+
+	// Tools, with the one a click places highlighted
+	for i, tool := range editorTools {
+		label := fmt.Sprintf("%d %s", i+1, tool.name)
+		color := rl.DarkGray
+		if i == e.tool {
+			label = "> " + label
+			color = rl.Yellow
+		}
+		rl.DrawText(label, 10, 40+int32(i)*22, 18, color)
+	}
+
+	counts := fmt.Sprintf("Obstacles: %d   Spawns: %d/%d   Bases: %d",
+		len(e.m.Obstacles), len(e.m.Spawns[sim.PlayerTeam]), len(e.m.Spawns[sim.EnemyTeam]), len(e.m.Zones))
+	rl.DrawText(counts, 10, 40+int32(len(editorTools))*22+10, 18, rl.Black)
+
+	help := []string{
+		"WASD/QE - Fly, Shift - Faster, Right Mouse - Look",
+		"Left Click - Select/Place, Drag - Move",
+		"R/Shift+R - Rotate, Wheel - Resize, Shift+Wheel - Height",
+		"Delete - Remove, Ctrl+Z/Ctrl+Y - Undo/Redo",
+		"Ctrl+S - Save, ESC - Menu",
+	}
+	screenHeight := int32(rl.GetScreenHeight())
+	for i, line := range help {
+		rl.DrawText(line, 10, screenHeight-150+int32(i)*22, 18, rl.Black)
+	}
+
+	if e.status != "" && rl.GetTime() < e.statusUntil {
+		screenWidth := int32(rl.GetScreenWidth())
+		rl.DrawText(e.status, screenWidth/2-rl.MeasureText(e.status, 20)/2, screenHeight-40, 20, rl.Maroon)
+	}
+}
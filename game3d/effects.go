@@ -0,0 +1,114 @@
+package game3d
+
+import (
+	"fmt"
+
+	"tanks3d/sim"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+// hitEffectTicks is how long an impact flash stays on screen.
+const hitEffectTicks = 20
+
+// hitMessageTicks is how long shell hit feedback stays on the HUD.
+const hitMessageTicks = 90
+
+// hitEffect is a short-lived flash where a shell struck something.
+type hitEffect struct {
+	position rl.Vector3
+	color    rl.Color
+	age      int     // Simulation ticks, so effects freeze while paused
+	size     float32 // How far it spreads; 0 is a shell's flash
+}
+
+// updateEffects turns new simulation events into effects and ages the
+// existing ones by the number of ticks just stepped.
+func (g *Game) updateEffects(ticks int) {
+	for i := len(g.effects) - 1; i >= 0; i-- {
+		g.effects[i].age += ticks
+		if g.effects[i].age >= hitEffectTicks {
+			g.effects = append(g.effects[:i], g.effects[i+1:]...)
+		}
+	}
+
+	for _, event := range g.drainEvents() {
+		g.stats.record(g.player, event)
+
+		switch event.Kind {
+		case sim.EventImpact:
+			g.effects = append(g.effects, hitEffect{position: vec3(event.Position), color: rl.LightGray})
+		case sim.EventTankHit:
+			color := rl.Orange
+			if event.Outcome != sim.Penetrated {
+				color = rl.White
+			}
+			g.effects = append(g.effects, hitEffect{position: vec3(event.Position), color: color})
+			g.reportHit(event)
+		case sim.EventRam:
+			g.effects = append(g.effects, hitEffect{position: vec3(event.Position), color: rl.Orange})
+		case sim.EventObstacleDestroyed:
+			// A cloud of dust as big as what came down
+			obstacle := event.Obstacle
+			center := rl.NewVector3(obstacle.Position.X, obstacle.Position.Y+obstacle.Size.Y/2, obstacle.Position.Z)
+			g.effects = append(g.effects, hitEffect{position: center, color: rl.Beige, size: obstacle.Size.Y})
+		case sim.EventCaptureReset:
+			g.hitMessage = "Capture reset"
+			g.hitMessageColor = rl.Yellow
+			g.hitMessageAge = 0
+		}
+	}
+
+	g.hitMessageAge += ticks
+}
+
+// drainEvents returns the match's new events, which the server reports
+// in a networked match.
+func (g *Game) drainEvents() []sim.Event {
+	if g.net != nil {
+		return g.net.DrainEvents()
+	}
+	return g.world.DrainEvents()
+}
+
+// reportHit shows the outcome of shells the player fired or was struck by.
+func (g *Game) reportHit(event sim.Event) {
+	message := event.Outcome.String()
+	if event.Outcome == sim.Penetrated {
+		message = fmt.Sprintf("%s! -%d", message, event.Damage)
+	}
+
+	switch g.player {
+	case event.Shooter:
+		g.hitMessage = message
+		g.hitMessageColor = rl.Green
+	case event.Tank:
+		g.hitMessage = "Hit: " + message
+		g.hitMessageColor = rl.Red
+	default:
+		return
+	}
+	g.hitMessageAge = 0
+}
+
+func (g *Game) drawHitMessage() {
+	if g.hitMessage == "" || g.hitMessageAge >= hitMessageTicks {
+		return
+	}
+
+	fontSize := int32(24)
+	x := int32(rl.GetScreenWidth())/2 - rl.MeasureText(g.hitMessage, fontSize)/2
+	y := int32(rl.GetScreenHeight())/2 + 110
+	rl.DrawText(g.hitMessage, x, y, fontSize, g.hitMessageColor)
+}
+
+func (g *Game) drawEffects() {
+	for _, effect := range g.effects {
+		progress := float32(effect.age) / hitEffectTicks
+		size := effect.size
+		if size == 0 {
+			size = 1.2
+		}
+		rl.DrawSphere(effect.position, 0.3+progress*size, rl.Fade(effect.color, 1-progress))
+	}
+}
@@ -4,34 +4,55 @@ import (
 	"fmt"
 	"math"
 
+	"tanks3d/netplay"
+	"tanks3d/sim"
+
 	rl "github.com/gen2brain/raylib-go/raylib"
 )
 
+// Aim range limits for the mouse wheel, in world units.
+const (
+	minAimRange     = 10.0
+	maxAimRange     = 200.0
+	defaultAimRange = 40.0
+)
+
+// Time scale limits for the slow-motion and fast-forward keys.
 const (
-	MapSize = 100.0
+	minTimeScale = 0.25
+	maxTimeScale = 4.0
 )
 
+// Game is the raylib frontend. It turns keyboard and mouse state into
+// sim.Input, steps the simulation at a fixed rate and renders the result.
+// In a networked match it sends the input to the server instead and draws
+// the server's state.
 type Game struct {
-	camera         rl.Camera3D
-	player         *Tank
-	enemies        []*Tank
-	bullets        []*Bullet
-	terrain        *Terrain
-	gameTime       int
-	mouseAiming    bool
-	aimingCircle   AimingCircle
+	camera          rl.Camera3D
+	world           *sim.Game
+	player          *sim.Tank
+	net             *netplay.Client
+	netErr          error // Why the connection ended, once it has
+	mouseAiming     bool
+	pendingFire     bool
+	replay          *sim.ReplayPlayer
+	recording       *sim.Replay
+	effects         []hitEffect
+	hitMessage      string
+	hitMessageColor rl.Color
+	hitMessageAge   int
+	aimRange        float32
+	aimPoint        sim.Vec3
+	stats           matchStats
+	ground          ground
 }
 
-type AimingCircle struct {
-	CurrentRadius float32
-	MinRadius     float32
-	MaxRadius     float32
-	ShrinkSpeed   float32
-	ExpandSpeed   float32
-	IsAiming      bool
+// NewGame starts a match from cfg.
+func NewGame(cfg sim.Config) *Game {
+	return newGame(sim.NewGame(cfg))
 }
 
-func NewGame() *Game {
+func newGame(world *sim.Game) *Game {
 	// Initialize camera
 	camera := rl.Camera3D{
 		Position:   rl.NewVector3(10, 15, 10),
@@ -41,115 +62,167 @@ func NewGame() *Game {
 		Projection: rl.CameraPerspective,
 	}
 
-	// Create player tank
-	player := NewTank(rl.NewVector3(0, 0, 0), true)
-
-	// Create enemy tanks
-	enemies := []*Tank{
-		NewTank(rl.NewVector3(20, 0, 20), false),
-		NewTank(rl.NewVector3(-20, 0, 20), false),
-		NewTank(rl.NewVector3(30, 0, -10), false),
+	return &Game{
+		camera:      camera,
+		world:       world,
+		player:      world.Player,
+		mouseAiming: true,
+		aimRange:    defaultAimRange,
+		ground:      loadGround(world.Terrain, world.Environment),
 	}
+}
 
-	// Create terrain
-	terrain := NewTerrain()
+// NewNetworkGame plays a match hosted on a server, in the tank the server
+// gave the client.
+func NewNetworkGame(client *netplay.Client) *Game {
+	g := newGame(client.World())
+	g.player = client.Tank()
+	g.net = client
+	return g
+}
 
-	// Initialize aiming circle
-	aimingCircle := AimingCircle{
-		CurrentRadius: 50.0,
-		MinRadius:     20.0,
-		MaxRadius:     80.0,
-		ShrinkSpeed:   1.5,
-		ExpandSpeed:   2.0,
-		IsAiming:      false,
+// unload frees the match's GPU resources once the App drops it, and leaves
+// a networked match.
+func (g *Game) unload() {
+	g.ground.unload()
+	if g.net != nil {
+		g.net.Close()
 	}
+}
 
-	return &Game{
-		camera:       camera,
-		player:       player,
-		enemies:      enemies,
-		bullets:      make([]*Bullet, 0),
-		terrain:      terrain,
-		mouseAiming:  true,
-		aimingCircle: aimingCircle,
-	}
+// NewReplayGame plays a recorded match back instead of reading the keyboard.
+func NewReplayGame(replay *sim.Replay) *Game {
+	g := NewGame(replay.Config)
+	g.replay = &sim.ReplayPlayer{Replay: replay}
+	return g
 }
 
-func (g *Game) Update() {
-	g.gameTime++
+// StartRecording captures the player's input from now on; Recording returns
+// the captured replay.
+func (g *Game) StartRecording() {
+	g.recording = g.world.Record()
+}
 
-	// Update player
-	g.player.Update()
-	g.handleInput()
+func (g *Game) Recording() *sim.Replay {
+	return g.recording
+}
 
-	// Update aiming system
-	g.updateAiming()
+// Update steps the match for one frame. Escape or P opens the pause menu,
+// and the results screen follows as soon as the match is over.
+func (g *Game) Update(app *App) {
+	if g.world.Over() {
+		app.push(newResults(g))
+		return
+	}
+	if rl.IsKeyPressed(rl.KeyEscape) || rl.IsKeyPressed(rl.KeyP) {
+		g.pendingFire = false // Not carried over to when play resumes
+		app.push(newPauseMenu(g))
+		return
+	}
 
-	// Update enemies with AI
-	for _, enemy := range g.enemies {
-		if enemy.Health > 0 {
-			g.updateEnemyAI(enemy)
-			enemy.Update()
-		}
+	// Take the cursor back for aiming after a menu
+	if g.mouseAiming && !rl.IsCursorHidden() {
+		rl.DisableCursor()
+	}
+
+	if g.net != nil {
+		g.updateNetwork(g.readInput())
+		return
 	}
 
-	// Update bullets
-	for i := len(g.bullets) - 1; i >= 0; i-- {
-		bullet := g.bullets[i]
-		bullet.Update()
+	g.handleTimeControls()
 
-		// Remove bullets that are out of bounds or expired
-		if bullet.Position.X < -MapSize || bullet.Position.X > MapSize ||
-			bullet.Position.Z < -MapSize || bullet.Position.Z > MapSize ||
-			bullet.LifeTime <= 0 {
-			g.bullets = append(g.bullets[:i], g.bullets[i+1:]...)
-			continue
-		}
+	if g.replay != nil {
+		g.updateReplay()
+		return
+	}
+
+	input := g.readInput()
 
-		// Check bullet collisions
-		g.checkBulletCollisions(bullet, i)
+	// Step the simulation at a fixed rate regardless of the frame rate
+	ticks := g.world.Update(rl.GetFrameTime(), input)
+	if ticks > 0 {
+		g.pendingFire = false
 	}
+	g.updateEffects(ticks)
 
 	// Update camera to follow player
 	g.updateCamera()
 }
 
-func (g *Game) handleInput() {
-	if g.player.Health <= 0 {
-		return
+// updateReplay steps the simulation with the recorded input of each tick.
+func (g *Game) updateReplay() {
+	ticks := g.world.Clock.Advance(rl.GetFrameTime())
+	for i := 0; i < ticks; i++ {
+		input, ok := g.replay.Next()
+		if !ok {
+			break
+		}
+		g.world.Step(input)
 	}
+	g.updateEffects(ticks)
 
-	// Tank movement
-	if rl.IsKeyDown(rl.KeyW) {
-		g.player.MoveForward()
-		g.aimingCircle.IsAiming = false // Движение ухудшает точность
+	g.updateCamera()
+}
+
+// updateNetwork moves the player's tank on the frame's input straight
+// away and sends it to the server, then catches up with what the server
+// has sent back.
+func (g *Game) updateNetwork(input sim.Input) {
+	ticks, err := g.net.Update(rl.GetFrameTime(), input)
+	if ticks > 0 {
+		g.pendingFire = false
 	}
-	if rl.IsKeyDown(rl.KeyS) {
-		g.player.MoveBackward()
-		g.aimingCircle.IsAiming = false
+	if err != nil && g.netErr == nil {
+		g.netErr = err
 	}
-	if rl.IsKeyDown(rl.KeyA) {
-		g.player.TurnLeft()
-		g.aimingCircle.IsAiming = false
+	g.updateEffects(ticks)
+
+	g.updateCamera()
+}
+
+func (g *Game) handleTimeControls() {
+	clock := &g.world.Clock
+
+	if rl.IsKeyPressed(rl.KeyMinus) && clock.Scale > minTimeScale {
+		clock.Scale /= 2
 	}
-	if rl.IsKeyDown(rl.KeyD) {
-		g.player.TurnRight()
-		g.aimingCircle.IsAiming = false
+	if rl.IsKeyPressed(rl.KeyEqual) && clock.Scale < maxTimeScale {
+		clock.Scale *= 2
+	}
+}
+
+func (g *Game) readInput() sim.Input {
+	input := sim.Input{
+		Forward:   rl.IsKeyDown(rl.KeyW),
+		Backward:  rl.IsKeyDown(rl.KeyS),
+		TurnLeft:  rl.IsKeyDown(rl.KeyA),
+		TurnRight: rl.IsKeyDown(rl.KeyD),
+		Aiming:    rl.IsMouseButtonDown(rl.MouseRightButton),
 	}
 
 	// Mouse aiming
 	if g.mouseAiming {
-		g.handleMouseAiming()
-	} else {
-		// Keyboard turret rotation (fallback)
-		if rl.IsKeyDown(rl.KeyLeft) {
-			g.player.TurretLeft()
-			g.aimingCircle.IsAiming = false
+		input.AimTurret = true
+		input.TurretAngle = g.handleMouseAiming()
+
+		// The wheel sets the range; the gun elevates to land on the aim point
+		g.aimRange += rl.GetMouseWheelMove() * 5
+		if g.aimRange < minAimRange {
+			g.aimRange = minAimRange
 		}
-		if rl.IsKeyDown(rl.KeyRight) {
-			g.player.TurretRight()
-			g.aimingCircle.IsAiming = false
+		if g.aimRange > maxAimRange {
+			g.aimRange = maxAimRange
 		}
+		g.aimPoint = g.resolveAimPoint(input.TurretAngle)
+		input.HasAimPoint = true
+		input.AimPoint = g.aimPoint
+	} else {
+		// Keyboard turret rotation (fallback)
+		input.TurretLeft = rl.IsKeyDown(rl.KeyLeft)
+		input.TurretRight = rl.IsKeyDown(rl.KeyRight)
+		input.GunUp = rl.IsKeyDown(rl.KeyUp)
+		input.GunDown = rl.IsKeyDown(rl.KeyDown)
 	}
 
 	// Toggle aiming mode
@@ -162,180 +235,119 @@ func (g *Game) handleInput() {
 		}
 	}
 
-	// Shooting
+	// Shooting; remember the press until a tick consumes it
 	if rl.IsMouseButtonPressed(rl.MouseLeftButton) || rl.IsKeyPressed(rl.KeySpace) {
-		if bullet := g.player.ShootWithAccuracy(g.aimingCircle.CurrentRadius); bullet != nil {
-			g.bullets = append(g.bullets, bullet)
-			g.aimingCircle.IsAiming = false // После выстрела точность сбрасывается
-		}
+		g.pendingFire = true
 	}
+	input.Fire = g.pendingFire
 
-	// Right mouse button for aiming
-	if rl.IsMouseButtonDown(rl.MouseRightButton) {
-		g.aimingCircle.IsAiming = true
-	} else if rl.IsMouseButtonReleased(rl.MouseRightButton) {
-		g.aimingCircle.IsAiming = false
-	}
+	return input
 }
 
-func (g *Game) handleMouseAiming() {
+// handleMouseAiming returns the turret angle the mouse points at and
+// recenters the cursor.
+func (g *Game) handleMouseAiming() float32 {
 	// Получаем позицию мыши
 	mousePos := rl.GetMousePosition()
 	screenCenter := rl.NewVector2(float32(rl.GetScreenWidth())/2, float32(rl.GetScreenHeight())/2)
-	
+
 	// Вычисляем смещение от центра экрана
 	deltaX := mousePos.X - screenCenter.X
 	deltaY := mousePos.Y - screenCenter.Y
-	
+
 	// Вычисляем угол поворота башни относительно корпуса танка
 	mouseAngle := math.Atan2(float64(deltaX), float64(-deltaY)) // -deltaY потому что Y инвертирован
-	
-	// Устанавливаем поворот башни
-	g.player.SetTurretRotation(float32(mouseAngle))
-	
+
 	// Возвращаем курсор в центр экрана для непрерывного управления
 	rl.SetMousePosition(int(screenCenter.X), int(screenCenter.Y))
-}
 
-func (g *Game) updateAiming() {
-	if g.aimingCircle.IsAiming {
-		// Сведение - уменьшаем круг точности
-		g.aimingCircle.CurrentRadius -= g.aimingCircle.ShrinkSpeed
-		if g.aimingCircle.CurrentRadius < g.aimingCircle.MinRadius {
-			g.aimingCircle.CurrentRadius = g.aimingCircle.MinRadius
-		}
-	} else {
-		// Разведение - увеличиваем круг точности
-		g.aimingCircle.CurrentRadius += g.aimingCircle.ExpandSpeed
-		if g.aimingCircle.CurrentRadius > g.aimingCircle.MaxRadius {
-			g.aimingCircle.CurrentRadius = g.aimingCircle.MaxRadius
-		}
-	}
+	return float32(mouseAngle)
 }
 
-func (g *Game) updateEnemyAI(enemy *Tank) {
-	// Simple AI: move towards player and shoot occasionally
-	dx := g.player.Position.X - enemy.Position.X
-	dz := g.player.Position.Z - enemy.Position.Z
-	distance := math.Sqrt(float64(dx*dx + dz*dz))
+// resolveAimPoint finds the spot the camera sees aimRange ahead along the
+// gun: the ground there, or the first obstacle in front of it.
+func (g *Game) resolveAimPoint(turretAngle float32) sim.Vec3 {
+	player := g.player
+	angle := float64(player.Rotation + turretAngle)
 
-	if distance > 5 {
-		// Calculate target angle
-		targetAngle := math.Atan2(float64(dx), float64(dz))
-		angleDiff := targetAngle - float64(enemy.Rotation)
+	x := player.Position.X + float32(math.Sin(angle))*g.aimRange
+	z := player.Position.Z + float32(math.Cos(angle))*g.aimRange
+	ground := sim.NewVec3(x, g.world.Terrain.HeightAt(x, z), z)
 
-		// Normalize angle difference
-		for angleDiff > math.Pi {
-			angleDiff -= 2 * math.Pi
-		}
-		for angleDiff < -math.Pi {
-			angleDiff += 2 * math.Pi
-		}
-
-		// Turn towards player
-		if math.Abs(angleDiff) > 0.1 {
-			if angleDiff > 0 {
-				enemy.TurnRight()
-			} else {
-				enemy.TurnLeft()
-			}
-		} else {
-			enemy.MoveForward()
-		}
-	}
-
-	// Aim turret at player
-	turretAngle := math.Atan2(float64(dx), float64(dz)) - float64(enemy.Rotation)
-	enemy.SetTurretRotation(float32(turretAngle))
-
-	// Shoot occasionally
-	if g.gameTime%180 == 0 && distance < 30 {
-		if bullet := enemy.ShootWithAccuracy(30.0); bullet != nil {
-			g.bullets = append(g.bullets, bullet)
-		}
+	// Nudge the target just above the ground so the sight line can reach it
+	eye := sim.NewVec3(g.camera.Position.X, g.camera.Position.Y, g.camera.Position.Z)
+	if hit, ok := g.world.Terrain.SegmentHit(eye, ground.Add(sim.NewVec3(0, 0.05, 0))); ok {
+		return hit
 	}
-}
-
-func (g *Game) checkBulletCollisions(bullet *Bullet, bulletIndex int) {
-	// Check collision with player
-	if !bullet.FromPlayer && g.player.Health > 0 {
-		if g.checkCollision(bullet.Position, g.player.Position, 2.0) {
-			g.player.TakeDamage(25)
-			g.bullets = append(g.bullets[:bulletIndex], g.bullets[bulletIndex+1:]...)
-			return
-		}
-	}
-
-	// Check collision with enemies
-	if bullet.FromPlayer {
-		for _, enemy := range g.enemies {
-			if enemy.Health > 0 && g.checkCollision(bullet.Position, enemy.Position, 2.0) {
-				enemy.TakeDamage(25)
-				g.bullets = append(g.bullets[:bulletIndex], g.bullets[bulletIndex+1:]...)
-				return
-			}
-		}
-	}
-}
-
-func (g *Game) checkCollision(pos1, pos2 rl.Vector3, radius float32) bool {
-	dx := pos1.X - pos2.X
-	dz := pos1.Z - pos2.Z
-	distance := math.Sqrt(float64(dx*dx + dz*dz))
-	return distance < float64(radius)
+	return ground
 }
 
 func (g *Game) updateCamera() {
+	player := g.player
+
 	// Third-person camera following the player
 	cameraDistance := float32(15)
 	cameraHeight := float32(8)
 
 	// Calculate camera position behind the tank
-	cameraX := g.player.Position.X - float32(math.Sin(float64(g.player.Rotation)))*cameraDistance
-	cameraZ := g.player.Position.Z - float32(math.Cos(float64(g.player.Rotation)))*cameraDistance
+	cameraX := player.Position.X - float32(math.Sin(float64(player.Rotation)))*cameraDistance
+	cameraZ := player.Position.Z - float32(math.Cos(float64(player.Rotation)))*cameraDistance
 
-	g.camera.Position = rl.NewVector3(cameraX, cameraHeight, cameraZ)
-	g.camera.Target = rl.NewVector3(g.player.Position.X, g.player.Position.Y+1, g.player.Position.Z)
+	// Stay above the ground, which may rise behind the tank
+	cameraY := player.Position.Y + cameraHeight
+	if floor := g.world.Terrain.HeightAt(cameraX, cameraZ) + 2; cameraY < floor {
+		cameraY = floor
+	}
+
+	g.camera.Position = rl.NewVector3(cameraX, cameraY, cameraZ)
+	g.camera.Target = rl.NewVector3(player.Position.X, player.Position.Y+1, player.Position.Z)
 }
 
+// Draw renders the match; the App begins and ends the frame.
 func (g *Game) Draw() {
-	rl.BeginDrawing()
-	rl.ClearBackground(rl.SkyBlue)
-
+	rl.ClearBackground(rgba(g.world.Environment.Sky))
 	rl.BeginMode3D(g.camera)
 
 	// Draw terrain
-	g.terrain.Draw()
+	drawTerrain(g.world.Terrain, g.ground)
+	g.drawZones()
 
 	// Draw tanks
-	g.player.Draw()
-	for _, enemy := range g.enemies {
-		if enemy.Health > 0 {
-			enemy.Draw()
+	team := g.player.Team
+	for _, t := range g.world.Tanks() {
+		// Enemies nobody on our side has spotted stay hidden
+		friendly := t.Team == team
+		if t.Health > 0 && (friendly || t.Spotted) {
+			drawTank(t, t == g.player, friendly)
 		}
 	}
 
 	// Draw bullets
-	for _, bullet := range g.bullets {
-		bullet.Draw()
+	for _, bullet := range g.world.Bullets {
+		drawBullet(bullet, bullet.Team == team)
 	}
 
-	// Draw grid for reference
-	rl.DrawGrid(100, 1.0)
+	// Draw shell impacts
+	g.drawEffects()
+
+	// Mark where the gun is ranged to
+	if g.mouseAiming && g.replay == nil {
+		rl.DrawCircle3D(rl.NewVector3(g.aimPoint.X, g.aimPoint.Y+0.05, g.aimPoint.Z), 1, rl.NewVector3(1, 0, 0), 90, rl.White)
+	}
 
 	rl.EndMode3D()
 
 	// Draw UI
 	g.drawUI()
-
-	rl.EndDrawing()
 }
 
 func (g *Game) drawUI() {
+	player := g.player
+
 	// Health bar
 	healthBarWidth := int32(200)
 	healthBarHeight := int32(20)
-	healthPercentage := float32(g.player.Health) / 100.0
+	healthPercentage := float32(player.Health) / float32(player.MaxHealth)
 
 	// Background
 	rl.DrawRectangle(10, 10, healthBarWidth, healthBarHeight, rl.Gray)
@@ -358,34 +370,75 @@ func (g *Game) drawUI() {
 		g.drawAimingCircle()
 	}
 
-	// Game status
-	if g.player.Health <= 0 {
-		rl.DrawText("GAME OVER - Press ESC to exit", 300, 350, 30, rl.Red)
+	// Warn the player when the enemy can see them
+	if player.Health > 0 && player.Spotted {
+		rl.DrawText("SPOTTED", int32(rl.GetScreenWidth())/2-50, 20, 24, rl.Orange)
 	}
 
-	// Enemy count
-	aliveEnemies := 0
-	for _, enemy := range g.enemies {
-		if enemy.Health > 0 {
-			aliveEnemies++
-		}
+	// Outcome of the latest shell the player fired or took
+	g.drawHitMessage()
+
+	// Countdown, clock, base capture and result
+	g.drawMatchStatus()
+
+	// Tank count per side
+	enemies := g.world.Alive(player.Team.Opponent())
+	enemyText := fmt.Sprintf("Enemies: %d", enemies)
+	if len(g.world.Allies) > 0 {
+		enemyText = fmt.Sprintf("Allies: %d  Enemies: %d", g.world.Alive(player.Team), enemies)
 	}
-	enemyText := fmt.Sprintf("Enemies: %d", aliveEnemies)
 	rl.DrawText(enemyText, 10, 60, 20, rl.Black)
 
+	// Seed, so bug reports can name the exact match
+	seedText := fmt.Sprintf("Seed: %d", g.world.Seed)
+	rl.DrawText(seedText, int32(rl.GetScreenWidth())-rl.MeasureText(seedText, 20)-10, 10, 20, rl.Black)
+
 	// Controls
-	controlsText := "WASD - Move, Mouse - Aim, LMB/Space - Shoot, RMB - Precise Aim, Tab - Toggle Mouse"
+	controlsText := "WASD - Move, Mouse - Aim, Wheel - Range, LMB/Space - Shoot, RMB - Precise Aim, Tab - Toggle Mouse, Esc/P - Pause, -/= - Speed"
 	rl.DrawText(controlsText, 10, 720, 16, rl.DarkGray)
-	
+
 	// Aiming mode indicator
 	if g.mouseAiming {
-		rl.DrawText("Mouse Aiming: ON", 10, 85, 20, rl.Green)
+		rl.DrawText(fmt.Sprintf("Mouse Aiming: ON  Range: %.0f", g.aimRange), 10, 85, 20, rl.Green)
 	} else {
 		rl.DrawText("Mouse Aiming: OFF", 10, 85, 20, rl.Red)
 	}
+
+	// Lines that only show some of the time stack up below, each on its
+	// own row
+	row := int32(110)
+	line := func(text string, color rl.Color) {
+		rl.DrawText(text, 10, row, 20, color)
+		row += 25
+	}
+
+	// Simulation speed
+	if g.world.Clock.Scale != 1 {
+		line(fmt.Sprintf("Speed: x%.2g", g.world.Clock.Scale), rl.Black)
+	}
+
+	// Replay progress
+	if g.replay != nil {
+		replayText := fmt.Sprintf("REPLAY %d/%d", g.replay.Pos, len(g.replay.Replay.Inputs))
+		if g.replay.Done() {
+			replayText = "REPLAY FINISHED"
+		}
+		line(replayText, rl.Maroon)
+	}
+
+	// Connection quality, or why a networked match ended early
+	if g.net != nil {
+		stats := g.net.Stats()
+		line(fmt.Sprintf("Ping: %d ms  Unacked: %d  Correction: %.2f", stats.RTT.Milliseconds(), stats.Pending, stats.Correction), rl.Black)
+		if g.netErr != nil && !g.world.Over() {
+			line(fmt.Sprintf("Disconnected: %v", g.netErr), rl.Maroon)
+		}
+	}
 }
 
 func (g *Game) drawAimingCircle() {
+	aimingCircle := g.player.AimingCircle
+
 	screenWidth := float32(rl.GetScreenWidth())
 	screenHeight := float32(rl.GetScreenHeight())
 	centerX := screenWidth / 2
@@ -393,8 +446,8 @@ func (g *Game) drawAimingCircle() {
 
 	// Цвет круга зависит от точности
 	var circleColor rl.Color
-	accuracy := (g.aimingCircle.MaxRadius - g.aimingCircle.CurrentRadius) / (g.aimingCircle.MaxRadius - g.aimingCircle.MinRadius)
-	
+	accuracy := (aimingCircle.MaxRadius - aimingCircle.CurrentRadius) / (aimingCircle.MaxRadius - aimingCircle.MinRadius)
+
 	if accuracy > 0.8 {
 		circleColor = rl.Green
 	} else if accuracy > 0.5 {
@@ -404,20 +457,20 @@ func (g *Game) drawAimingCircle() {
 	}
 
 	// Рисуем круг точности
-	rl.DrawCircleLines(int32(centerX), int32(centerY), g.aimingCircle.CurrentRadius, circleColor)
-	
+	rl.DrawCircleLines(int32(centerX), int32(centerY), aimingCircle.CurrentRadius, circleColor)
+
 	// Рисуем крестик в центре
 	crossSize := float32(10)
 	rl.DrawLine(int32(centerX-crossSize), int32(centerY), int32(centerX+crossSize), int32(centerY), rl.White)
 	rl.DrawLine(int32(centerX), int32(centerY-crossSize), int32(centerX), int32(centerY+crossSize), rl.White)
-	
+
 	// Показываем статус сведения
-	if g.aimingCircle.IsAiming {
-		rl.DrawText("AIMING...", int32(centerX-40), int32(centerY+g.aimingCircle.CurrentRadius+20), 20, circleColor)
+	if aimingCircle.IsAiming {
+		rl.DrawText("AIMING...", int32(centerX-40), int32(centerY+aimingCircle.CurrentRadius+20), 20, circleColor)
 	}
-	
+
 	// Показываем процент точности
 	accuracyPercent := int32(accuracy * 100)
 	accuracyText := fmt.Sprintf("Accuracy: %d%%", accuracyPercent)
-	rl.DrawText(accuracyText, int32(centerX-60), int32(centerY-g.aimingCircle.CurrentRadius-30), 20, circleColor)
-}
\ No newline at end of file
+	rl.DrawText(accuracyText, int32(centerX-60), int32(centerY-aimingCircle.CurrentRadius-30), 20, circleColor)
+}
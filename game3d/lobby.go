@@ -0,0 +1,278 @@
+package game3d
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"tanks3d/lobby"
+	"tanks3d/netplay"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+// lobbyRefresh is how often the battle list is fetched again.
+const lobbyRefresh = 2 * time.Second
+
+// lobbyScene lists a lobby's battles and joins one, or creates one to play
+// in. Talking to the lobby and connecting to a game server happen off the
+// render loop, one request at a time.
+type lobbyScene struct {
+	lobby   *lobby.Client
+	network netplay.Conditions
+	menu    menu
+
+	options lobby.Options
+	battles []lobby.Battle
+	join    lobby.JoinRequest
+	create  lobby.CreateRequest
+
+	status  string
+	busy    bool
+	results chan func(app *App) // Applied on the next Update once a request finishes
+	waited  float32             // Seconds since the list was fetched
+
+	mu     sync.Mutex      // Guards left and joined, which requests reach from their goroutine
+	left   bool            // Set once the scene is dropped from the stack
+	joined *netplay.Client // Connected to a battle but not playing it yet
+}
+
+func newLobby(client *lobby.Client, network netplay.Conditions) *lobbyScene {
+	s := &lobbyScene{
+		lobby:   client,
+		network: network,
+		create:  lobby.CreateRequest{Mode: "7v7", Difficulty: "normal"},
+		status:  "Connecting to " + client.URL(),
+		results: make(chan func(app *App), 1),
+	}
+	s.menu = menu{title: "LOBBY", top: 200}
+	s.rebuild()
+	s.refresh()
+	return s
+}
+
+// run does work in the background; what it returns is applied to the
+// scene and app from Update. A status of "" leaves the current one up.
+func (s *lobbyScene) run(status string, work func() func(app *App)) {
+	if s.busy {
+		return
+	}
+	s.busy = true
+	if status != "" {
+		s.status = status
+	}
+	go func() { s.results <- work() }()
+}
+
+func (s *lobbyScene) refresh() {
+	s.waited = 0
+	needOptions := len(s.options.Tanks) == 0
+	s.run("", func() func(app *App) {
+		var options lobby.Options
+		var err error
+		if needOptions {
+			options, err = s.lobby.Options()
+		}
+		var battles []lobby.Battle
+		if err == nil {
+			battles, err = s.lobby.Battles()
+		}
+		return func(*App) {
+			if err != nil {
+				s.status = fmt.Sprintf("Lobby unreachable: %v", err)
+				return
+			}
+			if needOptions {
+				s.options = options
+				s.status = fmt.Sprintf("Connected to %s", s.lobby.URL())
+			}
+			s.battles = battles
+			s.rebuild()
+		}
+	})
+}
+
+// enter joins a battle, creating it first when create is set, and starts
+// playing in it.
+func (s *lobbyScene) enter(id int, create bool) {
+	status := "Joining battle..."
+	if create {
+		status = "Creating battle..."
+	}
+	join, battle := s.join, s.create
+	s.run(status, func() func(app *App) {
+		fail := func(err error) func(app *App) {
+			return func(*App) { s.status = err.Error() }
+		}
+		if create {
+			created, err := s.lobby.Create(battle)
+			if err != nil {
+				return fail(err)
+			}
+			id = created.ID
+		}
+		ticket, err := s.lobby.Join(id, join)
+		if err != nil {
+			return fail(err)
+		}
+		client, err := netplay.Dial(ticket.Addr, ticket.Hello, s.network, 10*time.Second)
+		if err != nil {
+			return fail(fmt.Errorf("connecting to %s: %v", ticket.Addr, err))
+		}
+		if !s.hold(client) {
+			return func(*App) {}
+		}
+		return func(app *App) {
+			client := s.release()
+			if client == nil {
+				return
+			}
+			// The player may have moved on while connecting
+			if app.top() != Scene(s) {
+				client.Close()
+				return
+			}
+			s.status = ""
+			app.push(NewNetworkGame(client))
+		}
+	})
+}
+
+// hold keeps a newly connected client until Update hands it to a match,
+// or hangs up straight away if the scene is gone. It reports whether the
+// client was kept.
+func (s *lobbyScene) hold(client *netplay.Client) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.left {
+		client.Close()
+		return false
+	}
+	s.joined = client
+	return true
+}
+
+// release takes the held client, nil if unload hung up on it.
+func (s *lobbyScene) release() *netplay.Client {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	client := s.joined
+	s.joined = nil
+	return client
+}
+
+// unload hangs up on a battle connected to after the player left the
+// lobby, since nothing will play it.
+func (s *lobbyScene) unload() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.left = true
+	if s.joined != nil {
+		s.joined.Close()
+		s.joined = nil
+	}
+}
+
+// rebuild lays out the menu for the latest battle list, keeping the
+// selection where it was.
+func (s *lobbyScene) rebuild() {
+	join, create := &s.join, &s.create
+	items := []menuItem{
+		{
+			label:  func() string { return "Team: " + orDefault(join.Team, "either") },
+			change: func(delta int) { join.Team = cycleList([]string{"", "player", "enemy"}, join.Team, delta) },
+		},
+		{
+			label:  func() string { return "Tank: " + orDefault(join.Class, "as assigned") },
+			change: func(delta int) { join.Class = cycleList(append([]string{""}, s.options.Tanks...), join.Class, delta) },
+		},
+	}
+	for _, b := range s.battles {
+		id := b.ID
+		items = append(items, menuItem{label: text(battleLabel(b)), action: func(*App) { s.enter(id, false) }})
+	}
+	if len(s.battles) == 0 {
+		items = append(items, menuItem{label: text("No battles yet")})
+	}
+	items = append(items,
+		menuItem{label: text("Create Battle"), action: func(*App) { s.enter(0, true) }},
+		menuItem{
+			label:  func() string { return "New Battle Mode: " + create.Mode },
+			change: func(delta int) { create.Mode = cycleList(s.options.Modes, create.Mode, delta) },
+		},
+		menuItem{
+			label:  func() string { return "New Battle Difficulty: " + create.Difficulty },
+			change: func(delta int) { create.Difficulty = cycleList(s.options.Difficulties, create.Difficulty, delta) },
+		},
+		menuItem{
+			label:  func() string { return "New Battle Map: " + orDefault(create.Map, "generated") },
+			change: func(delta int) { create.Map = cycleList(append([]string{""}, s.options.Maps...), create.Map, delta) },
+		},
+		menuItem{label: text("Main Menu"), action: func(app *App) { app.mainMenu() }},
+	)
+
+	s.menu.items = items
+	s.menu.selected = min(s.menu.selected, len(items)-1)
+}
+
+func battleLabel(b lobby.Battle) string {
+	where := b.Mode
+	if b.Map != "" {
+		where += " on " + b.Map
+	}
+	return fmt.Sprintf("%s (%s) %d/%d vs %d/%d, %s", b.Name, where,
+		b.Players[0], b.Tanks[0], b.Players[1], b.Tanks[1], b.Phase)
+}
+
+func orDefault(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
+
+// cycleList steps through options, wrapping at either end.
+func cycleList(options []string, current string, delta int) string {
+	if len(options) == 0 {
+		return current
+	}
+	index := 0
+	for i, option := range options {
+		if option == current {
+			index = i
+		}
+	}
+	return options[(index+delta+len(options))%len(options)]
+}
+
+func (s *lobbyScene) Update(app *App) {
+	select {
+	case apply := <-s.results:
+		s.busy = false
+		apply(app)
+		if app.top() != Scene(s) {
+			return
+		}
+	default:
+	}
+
+	if rl.IsKeyPressed(rl.KeyEscape) {
+		app.mainMenu()
+		return
+	}
+	if s.waited += rl.GetFrameTime(); s.waited >= float32(lobbyRefresh.Seconds()) {
+		s.refresh()
+	}
+	s.menu.update(app)
+}
+
+func (s *lobbyScene) Draw() {
+	rl.ClearBackground(rl.DarkGray)
+	s.menu.draw()
+
+	screenWidth, screenHeight := int32(rl.GetScreenWidth()), int32(rl.GetScreenHeight())
+	rl.DrawText(s.status, screenWidth/2-rl.MeasureText(s.status, 20)/2, screenHeight-80, 20, rl.Yellow)
+
+	hint := "Up/Down - Select, Left/Right - Change, Enter - Join, Esc - Back"
+	rl.DrawText(hint, screenWidth/2-rl.MeasureText(hint, 16)/2, screenHeight-40, 16, rl.LightGray)
+}
@@ -0,0 +1,102 @@
+package game3d
+
+import (
+	"fmt"
+
+	"tanks3d/sim"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+// drawZones outlines each team's base on the ground, in the same colors the
+// teams' tanks are drawn in.
+func (g *Game) drawZones() {
+	for _, zone := range g.world.Zones {
+		drawZone(g.world.Terrain, zone, zone.Team == g.player.Team)
+	}
+}
+
+func drawZone(terrain *sim.Terrain, zone *sim.CaptureZone, friendly bool) {
+	color := rl.Red
+	if friendly {
+		color = rl.Blue
+	}
+
+	center := rl.NewVector3(zone.Center.X, terrain.HeightAt(zone.Center.X, zone.Center.Z)+0.05, zone.Center.Z)
+	rl.DrawCircle3D(center, zone.Radius, rl.NewVector3(1, 0, 0), 90, color)
+	rl.DrawCircle3D(center, zone.Radius-0.5, rl.NewVector3(1, 0, 0), 90, color)
+
+	// A filled disc grows towards the edge as the capture progresses
+	if zone.Progress > 0 {
+		rl.DrawCylinder(center, zone.Radius*zone.Progress, zone.Radius*zone.Progress, 0.02, 32, rl.Fade(color, 0.4))
+	}
+}
+
+// drawMatchStatus shows the countdown or battle clock and capture progress.
+func (g *Game) drawMatchStatus() {
+	world, player := g.world, g.player
+	screenWidth := int32(rl.GetScreenWidth())
+
+	centered := func(text string, y, fontSize int32, color rl.Color) {
+		rl.DrawText(text, screenWidth/2-rl.MeasureText(text, fontSize)/2, y, fontSize, color)
+	}
+
+	switch world.Match.Phase {
+	case sim.MatchCountdown:
+		seconds := (world.TimeLeft() + sim.TickRate - 1) / sim.TickRate
+		centered(fmt.Sprintf("Battle starts in %d", seconds), 300, 40, rl.Black)
+	case sim.MatchInProgress:
+		if left := world.TimeLeft(); left > 0 {
+			seconds := (left + sim.TickRate - 1) / sim.TickRate
+			centered(fmt.Sprintf("%d:%02d", seconds/60, seconds%60), 50, 24, rl.Black)
+		}
+	}
+
+	// Capture progress for any base under attack
+	y := int32(85)
+	for _, zone := range world.Zones {
+		if zone.Progress <= 0 {
+			continue
+		}
+		label, color := "Capturing enemy base", rl.Blue
+		if zone.Team == player.Team {
+			label, color = "Our base is being captured", rl.Red
+		}
+		centered(fmt.Sprintf("%s: %d%%", label, int(zone.Progress*100)), y, 20, color)
+		rl.DrawRectangle(screenWidth/2-100, y+22, 200, 8, rl.Gray)
+		rl.DrawRectangle(screenWidth/2-100, y+22, int32(200*zone.Progress), 8, color)
+		y += 40
+	}
+
+	// The results screen takes over once the match is over
+	if !world.Over() && player.Health <= 0 {
+		centered("DESTROYED - your team fights on", 350, 30, rl.Red)
+	}
+}
+
+// matchStats tallies the player's part in a match for the results screen.
+type matchStats struct {
+	kills       int
+	hits        int
+	damageDealt int
+	damageTaken int
+	killed      map[*sim.Tank]bool
+}
+
+// record counts a hit or ram event involving the player.
+func (s *matchStats) record(player *sim.Tank, event sim.Event) {
+	if event.Shooter == player && event.Kind == sim.EventTankHit {
+		s.hits++
+		s.damageDealt += event.Damage
+		if event.Tank.Health <= 0 && !s.killed[event.Tank] {
+			if s.killed == nil {
+				s.killed = make(map[*sim.Tank]bool)
+			}
+			s.killed[event.Tank] = true
+			s.kills++
+		}
+	}
+	if event.Tank == player {
+		s.damageTaken += event.Damage
+	}
+}
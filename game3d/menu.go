@@ -0,0 +1,360 @@
+package game3d
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+
+	"tanks3d/sim"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+const (
+	menuFontSize    = 28
+	menuItemSpacing = 44
+)
+
+// menuItem is one line of a menu. Items with change cycle through a
+// setting with Left/Right; the rest run action on Enter or a click.
+type menuItem struct {
+	label  func() string
+	action func(app *App)
+	change func(delta int)
+}
+
+// menu is a vertical list of items picked with the keyboard or mouse.
+type menu struct {
+	title    string
+	items    []menuItem
+	selected int
+	top      int32 // Screen Y of the first item
+}
+
+// text returns a label that never changes.
+func text(label string) func() string {
+	return func() string { return label }
+}
+
+func (m *menu) update(app *App) {
+	// Menus need the cursor the match captures for aiming
+	if rl.IsCursorHidden() {
+		rl.EnableCursor()
+	}
+
+	switch {
+	case rl.IsKeyPressed(rl.KeyUp) || rl.IsKeyPressed(rl.KeyW):
+		m.selected = (m.selected + len(m.items) - 1) % len(m.items)
+	case rl.IsKeyPressed(rl.KeyDown) || rl.IsKeyPressed(rl.KeyS):
+		m.selected = (m.selected + 1) % len(m.items)
+	}
+
+	// Moving the mouse over an item selects it, clicking activates it
+	clicked := false
+	mouse := rl.GetMousePosition()
+	for i := range m.items {
+		if rl.CheckCollisionPointRec(mouse, m.itemBounds(i)) {
+			if rl.GetMouseDelta() != (rl.Vector2{}) {
+				m.selected = i
+			}
+			clicked = i == m.selected && rl.IsMouseButtonPressed(rl.MouseLeftButton)
+		}
+	}
+
+	item := m.items[m.selected]
+	if item.change != nil {
+		switch {
+		case rl.IsKeyPressed(rl.KeyLeft) || rl.IsKeyPressed(rl.KeyA):
+			item.change(-1)
+		case rl.IsKeyPressed(rl.KeyRight) || rl.IsKeyPressed(rl.KeyD) || clicked:
+			item.change(1)
+		}
+		return
+	}
+	if item.action != nil && (clicked || rl.IsKeyPressed(rl.KeyEnter) || rl.IsKeyPressed(rl.KeySpace)) {
+		item.action(app)
+	}
+}
+
+func (m *menu) draw() {
+	screenWidth := int32(rl.GetScreenWidth())
+	rl.DrawText(m.title, screenWidth/2-rl.MeasureText(m.title, 50)/2, m.top-90, 50, rl.White)
+
+	for i, item := range m.items {
+		label := item.label()
+		color := rl.LightGray
+		if i == m.selected {
+			label = "> " + label + " <"
+			color = rl.Yellow
+		}
+		bounds := m.itemBounds(i)
+		rl.DrawText(label, screenWidth/2-rl.MeasureText(label, menuFontSize)/2, int32(bounds.Y), menuFontSize, color)
+	}
+}
+
+// itemBounds returns the clickable screen area of the i-th item.
+func (m *menu) itemBounds(i int) rl.Rectangle {
+	width := float32(400)
+	return rl.NewRectangle(
+		float32(rl.GetScreenWidth())/2-width/2,
+		float32(m.top+int32(i)*menuItemSpacing),
+		width,
+		menuFontSize,
+	)
+}
+
+// dim darkens whatever has been drawn so far, behind an overlay menu.
+func dim() {
+	rl.DrawRectangle(0, 0, int32(rl.GetScreenWidth()), int32(rl.GetScreenHeight()), rl.Fade(rl.Black, 0.6))
+}
+
+// cycle steps through sorted map keys, wrapping at either end.
+func cycle[V any](options map[string]V, current string, delta int) string {
+	keys := make([]string, 0, len(options))
+	for key := range options {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	index := sort.SearchStrings(keys, current)
+	if index == len(keys) || keys[index] != current {
+		index = 0
+	}
+	return keys[(index+delta+len(keys))%len(keys)]
+}
+
+// mainMenuScene is the title screen; it sets up and starts matches.
+type mainMenuScene struct {
+	menu menu
+}
+
+func newMainMenu(app *App) *mainMenuScene {
+	cfg := &app.config
+	if cfg.Mode == "" {
+		cfg.Mode = "skirmish"
+	}
+	if cfg.Difficulty == "" {
+		cfg.Difficulty = "normal"
+	}
+
+	s := &mainMenuScene{menu: menu{
+		title: "3D TANKS",
+		top:   300,
+		items: []menuItem{
+			{label: text("Start Battle"), action: func(app *App) {
+				app.startMatch(app.config)
+			}},
+			{
+				label:  func() string { return "Mode: " + cfg.Mode },
+				change: func(delta int) { cfg.Mode = cycle(sim.BattleModes, cfg.Mode, delta) },
+			},
+			{
+				label:  func() string { return "Difficulty: " + cfg.Difficulty },
+				change: func(delta int) { cfg.Difficulty = cycle(sim.AIProfiles, cfg.Difficulty, delta) },
+			},
+			{
+				label:  func() string { return fmt.Sprintf("Friendly Fire: %s", onOff(cfg.FriendlyFire)) },
+				change: func(int) { cfg.FriendlyFire = !cfg.FriendlyFire },
+			},
+			{label: text("Quit"), action: func(app *App) { app.quit = true }},
+		},
+	}}
+	if app.lobby != nil {
+		lobby := menuItem{label: text("Multiplayer Lobby"), action: func(app *App) {
+			app.push(newLobby(app.lobby, app.network))
+		}}
+		s.menu.items = slices.Insert(s.menu.items, 1, lobby)
+	}
+	return s
+}
+
+func (s *mainMenuScene) Update(app *App) {
+	s.menu.update(app)
+}
+
+func (s *mainMenuScene) Draw() {
+	rl.ClearBackground(rl.DarkGray)
+	s.menu.draw()
+
+	hint := "Up/Down - Select, Left/Right - Change, Enter - Confirm"
+	rl.DrawText(hint, int32(rl.GetScreenWidth())/2-rl.MeasureText(hint, 16)/2, int32(rl.GetScreenHeight())-40, 16, rl.LightGray)
+}
+
+func onOff(on bool) string {
+	if on {
+		return "on"
+	}
+	return "off"
+}
+
+// pauseScene sits on top of a match, which stops stepping while it is
+// covered, and frees the mouse. A networked match goes on underneath with
+// the player's tank standing still.
+type pauseScene struct {
+	game *Game
+	menu menu
+}
+
+func newPauseMenu(game *Game) *pauseScene {
+	s := &pauseScene{game: game}
+	s.menu = menu{
+		title: "PAUSED",
+		top:   300,
+		items: []menuItem{
+			{label: text("Resume"), action: s.resume},
+			{label: text("Restart"), action: func(app *App) { app.restart(false) }},
+			{label: text("Restart with New Seed"), action: func(app *App) { app.restart(true) }},
+			{label: text("Main Menu"), action: func(app *App) { app.mainMenu() }},
+			{label: text("Quit"), action: func(app *App) { app.quit = true }},
+		},
+	}
+	if game.net != nil {
+		// Nobody can restart a match hosted elsewhere
+		s.menu.items = append(s.menu.items[:1], s.menu.items[3:]...)
+		s.menu.items[1].label = text("Leave Battle")
+	}
+	return s
+}
+
+func (s *pauseScene) resume(app *App) {
+	app.pop()
+}
+
+func (s *pauseScene) Update(app *App) {
+	if rl.IsKeyPressed(rl.KeyEscape) || rl.IsKeyPressed(rl.KeyP) {
+		s.resume(app)
+		return
+	}
+	if s.game.net != nil {
+		s.game.updateNetwork(sim.Input{})
+	}
+	s.menu.update(app)
+}
+
+func (s *pauseScene) Draw() {
+	s.game.Draw()
+	dim()
+	s.menu.draw()
+}
+
+// resultsScene sums up a finished match over its final frame.
+type resultsScene struct {
+	game *Game
+	menu menu
+}
+
+func newResults(game *Game) *resultsScene {
+	s := &resultsScene{game: game, menu: menu{
+		title: resultTitle(game.world, game.player),
+		top:   400,
+		items: []menuItem{
+			{label: text("Play Again"), action: func(app *App) { app.restart(false) }},
+			{label: text("New Battle"), action: func(app *App) { app.restart(true) }},
+			{label: text("Main Menu"), action: func(app *App) { app.mainMenu() }},
+			{label: text("Quit"), action: func(app *App) { app.quit = true }},
+		},
+	}}
+	if game.net != nil {
+		s.menu.items = s.menu.items[2:]
+	}
+	return s
+}
+
+func (s *resultsScene) Update(app *App) {
+	s.menu.update(app)
+}
+
+func (s *resultsScene) Draw() {
+	s.game.Draw()
+	dim()
+	s.menu.draw()
+
+	world := s.game.world
+	stats := s.game.stats
+	lines := []string{
+		world.Match.End.String(),
+		fmt.Sprintf("Battle length: %d:%02d", (world.Clock.Tick-world.Match.StartTick)/sim.TickRate/60, (world.Clock.Tick-world.Match.StartTick)/sim.TickRate%60),
+		fmt.Sprintf("Kills: %d   Hits: %d   Damage dealt: %d   Damage taken: %d", stats.kills, stats.hits, stats.damageDealt, stats.damageTaken),
+		fmt.Sprintf("Seed: %d", world.Seed),
+	}
+	screenWidth := int32(rl.GetScreenWidth())
+	for i, line := range lines {
+		rl.DrawText(line, screenWidth/2-rl.MeasureText(line, 20)/2, 250+int32(i)*28, 20, rl.White)
+	}
+}
+
+// resultTitle names the outcome for the player's team, which in a
+// networked match may be either side.
+func resultTitle(world *sim.Game, player *sim.Tank) string {
+	winner, ok := world.Winner()
+	switch {
+	case !ok:
+		return "DRAW"
+	case winner == player.Team:
+		return "VICTORY"
+	}
+	return "DEFEAT"
+}
+
+// editorMenuScene pauses the map editor. Leaving it with unsaved changes
+// takes a second confirmation.
+type editorMenuScene struct {
+	editor  *Editor
+	menu    menu
+	confirm bool
+}
+
+func newEditorMenu(editor *Editor) *editorMenuScene {
+	s := &editorMenuScene{editor: editor}
+	leave := func(then func(app *App)) func(app *App) {
+		return func(app *App) {
+			if editor.modified && !s.confirm {
+				s.confirm = true
+				return
+			}
+			then(app)
+		}
+	}
+	s.menu = menu{
+		title: "MAP EDITOR",
+		top:   300,
+		items: []menuItem{
+			{label: text("Resume"), action: s.resume},
+			{label: text("Save"), action: func(app *App) {
+				editor.save()
+				s.resume(app)
+			}},
+			{label: s.leaveLabel("Main Menu"), action: leave(func(app *App) { app.mainMenu() })},
+			{label: s.leaveLabel("Quit"), action: leave(func(app *App) { app.quit = true })},
+		},
+	}
+	return s
+}
+
+// leaveLabel warns about unsaved changes once the player tries to leave.
+func (s *editorMenuScene) leaveLabel(label string) func() string {
+	return func() string {
+		if s.confirm {
+			return label + " (discard changes?)"
+		}
+		return label
+	}
+}
+
+func (s *editorMenuScene) resume(app *App) {
+	app.pop()
+}
+
+func (s *editorMenuScene) Update(app *App) {
+	if rl.IsKeyPressed(rl.KeyEscape) {
+		s.resume(app)
+		return
+	}
+	s.menu.update(app)
+}
+
+func (s *editorMenuScene) Draw() {
+	s.editor.Draw()
+	dim()
+	s.menu.draw()
+}
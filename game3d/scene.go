@@ -0,0 +1,171 @@
+package game3d
+
+import (
+	"tanks3d/lobby"
+	"tanks3d/netplay"
+	"tanks3d/sim"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+// Scene is one screen of the frontend: the main menu, a match, the pause
+// menu or the results. Only the scene on top of the stack updates and is
+// drawn; overlays such as the pause menu draw the match beneath themselves.
+type Scene interface {
+	Update(app *App)
+	Draw()
+}
+
+// App runs the frontend's scene stack, from the main menu through matches
+// and back.
+type App struct {
+	// config is what the main menu starts the next match with
+	config sim.Config
+	replay *sim.Replay
+	record bool
+
+	// lobby finds networked battles, joined under network conditions
+	lobby   *lobby.Client
+	network netplay.Conditions
+
+	scenes    []Scene
+	match     sim.Config // Config of the match in progress, for restarts
+	replaying bool       // Whether that match is the replay
+	recording *sim.Replay
+	quit      bool
+}
+
+// NewApp opens on the main menu. Matches start from cfg, with the mode and
+// difficulty picked in the menu; when record is set each match's input is
+// captured so the latest can be saved with Recording.
+func NewApp(cfg sim.Config, record bool) *App {
+	a := &App{config: cfg, record: record}
+	a.scenes = []Scene{newMainMenu(a)}
+	return a
+}
+
+// NewEditorApp opens the map editor on m, with the main menu behind it.
+func NewEditorApp(cfg sim.Config, path string, m *sim.Map) *App {
+	a := &App{config: cfg}
+	a.scenes = []Scene{newMainMenu(a), NewEditor(path, m)}
+	return a
+}
+
+// NewNetworkApp joins the match client is connected to, with the main
+// menu behind it for local matches from cfg afterwards.
+func NewNetworkApp(cfg sim.Config, client *netplay.Client) *App {
+	a := &App{config: cfg}
+	a.scenes = []Scene{newMainMenu(a), NewNetworkGame(client)}
+	return a
+}
+
+// NewLobbyApp opens on the battle list of a lobby, with the main menu
+// behind it for local matches from cfg. Battles are joined under the
+// given network conditions.
+func NewLobbyApp(cfg sim.Config, client *lobby.Client, network netplay.Conditions) *App {
+	a := &App{config: cfg, lobby: client, network: network}
+	a.scenes = []Scene{newMainMenu(a), newLobby(client, network)}
+	return a
+}
+
+// NewReplayApp plays a replay straight away, with the main menu behind it.
+func NewReplayApp(replay *sim.Replay) *App {
+	a := &App{config: replay.Config, replay: replay}
+	a.scenes = []Scene{newMainMenu(a)}
+	a.playReplay()
+	return a
+}
+
+func (a *App) Update() {
+	a.top().Update(a)
+}
+
+func (a *App) Draw() {
+	rl.BeginDrawing()
+	rl.ClearBackground(rl.SkyBlue)
+	a.top().Draw()
+	rl.EndDrawing()
+}
+
+// Done reports whether the player chose to quit.
+func (a *App) Done() bool {
+	return a.quit
+}
+
+// Recording returns the input of the latest recorded match, or nil.
+func (a *App) Recording() *sim.Replay {
+	return a.recording
+}
+
+func (a *App) top() Scene {
+	return a.scenes[len(a.scenes)-1]
+}
+
+func (a *App) push(s Scene) {
+	a.scenes = append(a.scenes, s)
+}
+
+func (a *App) pop() {
+	if len(a.scenes) > 1 {
+		a.scenes = a.scenes[:len(a.scenes)-1]
+	}
+}
+
+// mainMenu drops every scene above the main menu, freeing the GPU
+// resources or connections of those that hold any.
+func (a *App) mainMenu() {
+	for _, s := range a.scenes[1:] {
+		if u, ok := s.(interface{ unload() }); ok {
+			u.unload()
+		}
+	}
+	a.scenes = a.scenes[:1]
+}
+
+// startMatch replaces whatever is above the main menu with a new match.
+func (a *App) startMatch(cfg sim.Config) {
+	game := NewGame(cfg)
+	if a.record {
+		game.StartRecording()
+		a.recording = game.Recording()
+	}
+	a.begin(cfg, false)
+	a.mainMenu()
+	a.push(game)
+}
+
+func (a *App) playReplay() {
+	a.begin(a.replay.Config, true)
+	a.mainMenu()
+	a.push(NewReplayGame(a.replay))
+}
+
+// begin notes the match that is starting, for restarts.
+func (a *App) begin(cfg sim.Config, replaying bool) {
+	a.match = cfg
+	a.replaying = replaying
+}
+
+// restart rebuilds the current match, on the same seed or a fresh one. A
+// replay restarts from the beginning.
+func (a *App) restart(newSeed bool) {
+	if cfg, replay := a.next(newSeed); replay {
+		a.playReplay()
+	} else {
+		a.startMatch(cfg)
+	}
+}
+
+// next returns the match a restart plays: the replay again, or the
+// current match's config with a fresh seed if asked for. A match started
+// from the menu after watching a replay restarts as itself.
+func (a *App) next(newSeed bool) (cfg sim.Config, replay bool) {
+	if a.replaying && !newSeed {
+		return a.replay.Config, true
+	}
+	cfg = a.match
+	if newSeed {
+		cfg.Seed = sim.NewSeed()
+	}
+	return cfg, false
+}
@@ -0,0 +1,40 @@
+package game3d
+
+import (
+	"testing"
+
+	"tanks3d/sim"
+)
+
+// The restart tests only go through the App's bookkeeping, so they run
+// without a window.
+
+func TestRestartReplay(t *testing.T) {
+	replay := &sim.Replay{Config: sim.Config{Seed: 7, Mode: "7v7"}}
+	a := &App{config: sim.Config{Seed: 1, Mode: "skirmish"}, replay: replay}
+	a.begin(replay.Config, true)
+
+	if cfg, again := a.next(false); !again || cfg.Seed != replay.Config.Seed {
+		t.Errorf("restarting the replay plays seed %d (replay %v), want the replay", cfg.Seed, again)
+	}
+	if cfg, again := a.next(true); again || cfg.Mode != replay.Config.Mode || cfg.Seed == replay.Config.Seed {
+		t.Errorf("new seed after the replay plays %s seed %d (replay %v), want a fresh %s match", cfg.Mode, cfg.Seed, again, replay.Config.Mode)
+	}
+}
+
+func TestRestartAfterReplay(t *testing.T) {
+	replay := &sim.Replay{Config: sim.Config{Seed: 7, Mode: "7v7"}}
+	a := &App{config: sim.Config{Seed: 1, Mode: "skirmish"}, replay: replay}
+	a.begin(replay.Config, true)
+
+	// The player leaves the replay for a battle from the main menu
+	a.begin(a.config, false)
+
+	cfg, again := a.next(false)
+	if again || cfg.Seed != a.config.Seed || cfg.Mode != a.config.Mode {
+		t.Errorf("restart plays %s seed %d (replay %v), want the battle started from the menu", cfg.Mode, cfg.Seed, again)
+	}
+	if cfg, again := a.next(true); again || cfg.Mode != a.config.Mode || cfg.Seed == a.config.Seed {
+		t.Errorf("new seed plays %s seed %d (replay %v), want a fresh %s match", cfg.Mode, cfg.Seed, again, a.config.Mode)
+	}
+}
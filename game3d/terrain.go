@@ -1,94 +1,100 @@
 package game3d
 
 import (
-	"math/rand"
+	"image"
+	"image/color"
+
+	"tanks3d/sim"
 
 	rl "github.com/gen2brain/raylib-go/raylib"
 )
 
-type Obstacle struct {
-	Position rl.Vector3
-	Size     rl.Vector3
-	Color    rl.Color
-	Type     string
-}
-
-type Terrain struct {
-	Obstacles []Obstacle
+// ground is the heightmap's mesh and the texture shading it.
+type ground struct {
+	model   rl.Model
+	texture rl.Texture2D
 }
 
-func NewTerrain() *Terrain {
-	obstacles := make([]Obstacle, 0)
-
-	// Generate random obstacles (buildings, rocks, trees)
-	for i := 0; i < 30; i++ {
-		obstacle := Obstacle{
-			Position: rl.NewVector3(
-				(rand.Float32()-0.5)*MapSize*1.5,
-				0,
-				(rand.Float32()-0.5)*MapSize*1.5,
-			),
-			Size: rl.NewVector3(
-				2+rand.Float32()*4,
-				1+rand.Float32()*3,
-				2+rand.Float32()*4,
-			),
-			Color: rl.Brown,
-			Type:  "building",
+// loadGround builds a mesh of the terrain's heightmap, shaded from the
+// environment's lowland color to its hilltop color. It must be unloaded when
+// the match ends.
+func loadGround(t *sim.Terrain, env sim.Environment) ground {
+	h := t.Ground
+	lowlandColor, hilltopColor := rgba(env.Lowland), rgba(env.Hilltop)
+	heights := image.NewGray(image.Rect(0, 0, h.Size, h.Size))
+	shades := image.NewRGBA(heights.Rect)
+	for z := 0; z < h.Size; z++ {
+		for x := 0; x < h.Size; x++ {
+			sample := h.Samples[z*h.Size+x]
+			heights.SetGray(x, z, color.Gray{Y: sample})
+			shades.SetRGBA(x, z, lerpColor(lowlandColor, hilltopColor, float32(sample)/255))
 		}
-		obstacles = append(obstacles, obstacle)
 	}
 
-	// Add some trees
-	for i := 0; i < 50; i++ {
-		obstacle := Obstacle{
-			Position: rl.NewVector3(
-				(rand.Float32()-0.5)*MapSize*1.8,
-				0,
-				(rand.Float32()-0.5)*MapSize*1.8,
-			),
-			Size: rl.NewVector3(
-				0.5+rand.Float32(),
-				3+rand.Float32()*2,
-				0.5+rand.Float32(),
-			),
-			Color: rl.DarkGreen,
-			Type:  "tree",
-		}
-		obstacles = append(obstacles, obstacle)
-	}
+	heightImage := rl.NewImageFromImage(heights)
+	shadeImage := rl.NewImageFromImage(shades)
+	defer rl.UnloadImage(heightImage)
+	defer rl.UnloadImage(shadeImage)
 
-	return &Terrain{
-		Obstacles: obstacles,
+	g := ground{
+		model:   rl.LoadModelFromMesh(rl.GenMeshHeightmap(*heightImage, rl.NewVector3(t.Size*2, h.Height, t.Size*2))),
+		texture: rl.LoadTextureFromImage(shadeImage),
 	}
+	rl.SetMaterialTexture(g.model.Materials, rl.MapDiffuse, g.texture)
+	return g
+}
+
+// unload frees the mesh and texture; the model doesn't own its texture.
+func (g ground) unload() {
+	rl.UnloadModel(g.model)
+	rl.UnloadTexture(g.texture)
 }
 
-func (t *Terrain) Draw() {
-	// Draw ground plane
-	rl.DrawPlane(rl.NewVector3(0, -0.5, 0), rl.NewVector2(MapSize*2, MapSize*2), rl.Green)
+// rgba converts a map color to an opaque image color.
+func rgba(c sim.Color) color.RGBA {
+	return color.RGBA{R: c[0], G: c[1], B: c[2], A: 255}
+}
 
-	// Draw obstacles
+func lerpColor(a, b color.RGBA, t float32) color.RGBA {
+	mix := func(x, y uint8) uint8 { return uint8(float32(x) + (float32(y)-float32(x))*t) }
+	return color.RGBA{R: mix(a.R, b.R), G: mix(a.G, b.G), B: mix(a.B, b.B), A: 255}
+}
+
+func drawTerrain(t *sim.Terrain, ground ground) {
+	// Draw the heightmap, whose mesh starts at the map's corner
+	rl.DrawModel(ground.model, rl.NewVector3(-t.Size, sim.GroundLevel, -t.Size), 1, rl.White)
+
+	// Draw obstacles, each turned about its base
 	for _, obstacle := range t.Obstacles {
+		rl.PushMatrix()
+		rl.Translatef(obstacle.Position.X, obstacle.Position.Y, obstacle.Position.Z)
+		rl.Rotatef(obstacle.Rotation*rl.Rad2deg, 0, 1, 0)
 		switch obstacle.Type {
 		case "building":
-			rl.DrawCubeV(
-				rl.NewVector3(obstacle.Position.X, obstacle.Position.Y+obstacle.Size.Y/2, obstacle.Position.Z),
-				obstacle.Size,
-				obstacle.Color,
-			)
+			rl.DrawCubeV(rl.NewVector3(0, obstacle.Size.Y/2, 0), vec3(obstacle.Size), rl.Brown)
+		case "rubble":
+			rl.DrawCubeV(rl.NewVector3(0, obstacle.Size.Y/2, 0), vec3(obstacle.Size), rl.DarkBrown)
 		case "tree":
 			// Tree trunk
-			rl.DrawCubeV(
-				rl.NewVector3(obstacle.Position.X, obstacle.Position.Y+obstacle.Size.Y/2, obstacle.Position.Z),
-				rl.NewVector3(obstacle.Size.X, obstacle.Size.Y, obstacle.Size.Z),
-				rl.Brown,
-			)
+			rl.DrawCubeV(rl.NewVector3(0, obstacle.Size.Y/2, 0), vec3(obstacle.Size), rl.Brown)
 			// Tree crown
-			rl.DrawSphere(
-				rl.NewVector3(obstacle.Position.X, obstacle.Position.Y+obstacle.Size.Y+1, obstacle.Position.Z),
-				1.5,
-				rl.DarkGreen,
-			)
+			rl.DrawSphere(rl.NewVector3(0, obstacle.Size.Y+1, 0), 1.5, rl.DarkGreen)
 		}
+		rl.PopMatrix()
+	}
+
+	// Fallen trees lie along their length, crown at the far end
+	for _, debris := range t.Debris {
+		rl.PushMatrix()
+		rl.Translatef(debris.Position.X, t.HeightAt(debris.Position.X, debris.Position.Z), debris.Position.Z)
+		rl.Rotatef(debris.Rotation*rl.Rad2deg, 0, 1, 0)
+		rl.DrawCubeV(rl.NewVector3(0, debris.Size.Y/2, 0), vec3(debris.Size), rl.Brown)
+		rl.DrawSphere(rl.NewVector3(0, 1, debris.Size.Z/2+1), 1.5, rl.DarkGreen)
+		rl.PopMatrix()
 	}
-}
\ No newline at end of file
+}
+
+// vec3 converts a simulation vector to its raylib counterpart.
+func vec3(v sim.Vec3) rl.Vector3 {
+	return rl.NewVector3(v.X, v.Y, v.Z)
+}
@@ -0,0 +1,119 @@
+// Package matchflags holds the command-line flags the game, tankserver and
+// lobby set matches up with, and turns them into a sim.Config.
+package matchflags
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"time"
+
+	"tanks3d/sim"
+)
+
+// Groups picks which flags beyond the tank classes and rules a command
+// takes.
+type Groups int
+
+const (
+	// Battle is --seed, --difficulty, --mode, --heightmap and --map, for
+	// commands that set up one particular match.
+	Battle Groups = 1 << iota
+	// Rewind is --max-rewind, for commands that host networked matches.
+	Rewind
+)
+
+// Flags are the match settings read from the command line.
+type Flags struct {
+	Seed          int64
+	TanksDir      string
+	PlayerClass   string
+	AllyClasses   string
+	EnemyClasses  string
+	Difficulty    string
+	Mode          string
+	FriendlyFire  bool
+	HeightmapPath string
+	MapPath       string
+	TimeLimit     time.Duration
+	MaxRewind     time.Duration
+}
+
+// Register adds the flags in groups to fs, with mode as the default battle
+// mode. Settings without a flag keep their defaults.
+func Register(fs *flag.FlagSet, groups Groups, mode string) *Flags {
+	f := &Flags{Difficulty: "normal", Mode: mode}
+
+	fs.StringVar(&f.TanksDir, "tanks", "data/tanks", "directory of tank class definitions")
+	fs.StringVar(&f.PlayerClass, "tank", "medium", "tank class for the player, the first tank on the player team")
+	fs.StringVar(&f.AllyClasses, "allies", "medium", "comma-separated tank classes for the rest of the player team")
+	fs.StringVar(&f.EnemyClasses, "enemies", "medium", "comma-separated tank classes for the enemy team")
+	fs.BoolVar(&f.FriendlyFire, "friendly-fire", false, "let shells and rams damage allies")
+	fs.DurationVar(&f.TimeLimit, "time-limit", sim.DefaultTimeLimit, "battle length before it ends in a draw (0 for none)")
+
+	if groups&Battle != 0 {
+		fs.Int64Var(&f.Seed, "seed", 0, "random seed for terrain, shot spread and AI (0 picks one)")
+		fs.StringVar(&f.Difficulty, "difficulty", f.Difficulty, "AI difficulty: easy, normal or hard")
+		fs.StringVar(&f.Mode, "mode", f.Mode, "battle mode: skirmish, 7v7 or 15v15")
+		fs.StringVar(&f.HeightmapPath, "heightmap", "", "grayscale PNG to use as the ground (default: hills generated from the seed)")
+		fs.StringVar(&f.MapPath, "map", "", "map file to fight on (default: a battlefield generated from the seed)")
+	}
+	if groups&Rewind != 0 {
+		fs.DurationVar(&f.MaxRewind, "max-rewind", sim.DefaultMaxRewind, "furthest back a lagging player's shots are checked against their targets (0 turns lag compensation off)")
+	}
+	return f
+}
+
+// Config checks the flags and loads the tank classes, heightmap and map
+// they name. It returns the match config, with a seed picked when none
+// was given, and every tank class loaded.
+func (f *Flags) Config() (sim.Config, map[string]sim.TankClass, error) {
+	if _, ok := sim.AIProfiles[f.Difficulty]; !ok {
+		return sim.Config{}, nil, fmt.Errorf("unknown difficulty %q", f.Difficulty)
+	}
+	if _, ok := sim.BattleModes[f.Mode]; !ok {
+		return sim.Config{}, nil, fmt.Errorf("unknown battle mode %q", f.Mode)
+	}
+	if f.MapPath != "" && f.HeightmapPath != "" {
+		return sim.Config{}, nil, errors.New("--map and --heightmap can't be used together; a map names its own heightmap")
+	}
+
+	cfg := sim.Config{
+		Seed:         f.Seed,
+		RamDamage:    sim.DefaultRamDamage,
+		Difficulty:   f.Difficulty,
+		Mode:         f.Mode,
+		FriendlyFire: f.FriendlyFire,
+		Countdown:    sim.DefaultCountdown,
+		TimeLimit:    f.TimeLimit,
+		MaxRewind:    f.MaxRewind,
+	}
+	if cfg.Seed == 0 {
+		cfg.Seed = sim.NewSeed()
+	}
+
+	classes, err := sim.LoadTankClasses(f.TanksDir)
+	if err != nil {
+		return sim.Config{}, nil, fmt.Errorf("loading tank classes: %w", err)
+	}
+	if cfg.PlayerClass, err = sim.FindTankClass(classes, f.PlayerClass); err != nil {
+		return sim.Config{}, nil, err
+	}
+	if cfg.AllyClasses, err = sim.FindTankClasses(classes, f.AllyClasses); err != nil {
+		return sim.Config{}, nil, err
+	}
+	if cfg.EnemyClasses, err = sim.FindTankClasses(classes, f.EnemyClasses); err != nil {
+		return sim.Config{}, nil, err
+	}
+	if f.HeightmapPath != "" {
+		if cfg.Heightmap, err = sim.LoadHeightmap(f.HeightmapPath, sim.HillHeight); err != nil {
+			return sim.Config{}, nil, fmt.Errorf("loading heightmap: %w", err)
+		}
+	}
+	if f.MapPath != "" {
+		if cfg.Map, err = sim.LoadMap(f.MapPath); err != nil {
+			return sim.Config{}, nil, fmt.Errorf("loading map: %w", err)
+		}
+	}
+	return cfg, classes, nil
+}
@@ -0,0 +1,64 @@
+package matchflags
+
+import (
+	"flag"
+	"io"
+	"strings"
+	"testing"
+)
+
+func parse(t *testing.T, groups Groups, args ...string) *Flags {
+	t.Helper()
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	f := Register(fs, groups, "skirmish")
+	if err := fs.Parse(append([]string{"--tanks", "../../data/tanks"}, args...)); err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func TestConfig(t *testing.T) {
+	cfg, classes, err := parse(t, Battle, "--seed", "5", "--mode", "7v7", "--tank", "heavy", "--enemies", "light,heavy").Config()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Seed != 5 || cfg.Mode != "7v7" || cfg.Difficulty != "normal" || cfg.MaxRewind != 0 {
+		t.Errorf("got seed %d, mode %s, difficulty %s, max rewind %v", cfg.Seed, cfg.Mode, cfg.Difficulty, cfg.MaxRewind)
+	}
+	if cfg.PlayerClass.Name != "heavy" || len(cfg.EnemyClasses) != 2 || cfg.EnemyClasses[1].Name != "heavy" {
+		t.Errorf("got player %s and enemies %v", cfg.PlayerClass.Name, cfg.EnemyClasses)
+	}
+	if _, ok := classes["light"]; !ok {
+		t.Errorf("loaded classes %v, want every one in the directory", classes)
+	}
+
+	// A command without the battle flags keeps the defaults, with a seed
+	// picked for it
+	cfg, _, err = parse(t, Rewind).Config()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Seed == 0 || cfg.Mode != "skirmish" || cfg.MaxRewind == 0 {
+		t.Errorf("got seed %d, mode %s, max rewind %v", cfg.Seed, cfg.Mode, cfg.MaxRewind)
+	}
+}
+
+func TestConfigRefused(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"--mode", "1v99"}, "unknown battle mode"},
+		{[]string{"--difficulty", "impossible"}, "unknown difficulty"},
+		{[]string{"--map", "a.json", "--heightmap", "b.png"}, "can't be used together"},
+		{[]string{"--tank", "hovercraft"}, "hovercraft"},
+		{[]string{"--map", "missing.json"}, "loading map"},
+	}
+	for _, tt := range tests {
+		_, _, err := parse(t, Battle, tt.args...).Config()
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%v: got %v, want %q", tt.args, err, tt.want)
+		}
+	}
+}
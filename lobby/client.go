@@ -0,0 +1,88 @@
+package lobby
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Client talks to a lobby Service.
+type Client struct {
+	url  string
+	http *http.Client
+}
+
+// NewClient returns a client for the lobby at url, such as
+// "http://localhost:8080".
+func NewClient(url string) *Client {
+	return &Client{
+		url:  strings.TrimSuffix(url, "/"),
+		http: &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+// URL returns the lobby's address.
+func (c *Client) URL() string {
+	return c.url
+}
+
+// Options returns what battles can be created and joined with.
+func (c *Client) Options() (Options, error) {
+	var options Options
+	return options, c.call(http.MethodGet, "/options", nil, &options)
+}
+
+// Battles lists the battles under way or waiting for players.
+func (c *Client) Battles() ([]Battle, error) {
+	var battles []Battle
+	return battles, c.call(http.MethodGet, "/battles", nil, &battles)
+}
+
+// Create starts a new battle.
+func (c *Client) Create(req CreateRequest) (Battle, error) {
+	var battle Battle
+	return battle, c.call(http.MethodPost, "/battles", req, &battle)
+}
+
+// Join asks for a place in a battle and returns what to connect with.
+func (c *Client) Join(id int, req JoinRequest) (Ticket, error) {
+	var ticket Ticket
+	return ticket, c.call(http.MethodPost, fmt.Sprintf("/battles/%d/join", id), req, &ticket)
+}
+
+func (c *Client) call(method, path string, body, out any) error {
+	var payload io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		payload = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, c.url+path, payload)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// Refusals come back as plain text
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		if len(message) == 0 {
+			return errors.New(resp.Status)
+		}
+		return errors.New(strings.TrimSpace(string(message)))
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
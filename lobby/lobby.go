@@ -0,0 +1,384 @@
+// Package lobby helps players find networked matches. A Service lists the
+// open battles over HTTP, creates new ones and hands joining players the
+// address of the game server to connect to with netplay.Dial. It hosts
+// every battle's netplay.Server itself, which is all a single machine
+// needs; Client talks to it.
+package lobby
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"tanks3d/netplay"
+	"tanks3d/sim"
+)
+
+// Battle is a match the lobby lists.
+type Battle struct {
+	ID         int
+	Name       string
+	Mode       string
+	Difficulty string
+	Map        string // Empty for a battlefield generated from the seed
+	Addr       string // Game server to connect to
+	netplay.Status
+}
+
+// Open reports whether the battle has a free tank on the team, or on
+// either when team is netplay.AnyTeam.
+func (b Battle) Open(team sim.Team) bool {
+	if b.Phase != sim.MatchCountdown && b.Phase != sim.MatchInProgress {
+		return false
+	}
+	free := func(t sim.Team) bool { return b.Players[t] < b.Tanks[t] }
+	if team == netplay.AnyTeam {
+		return free(sim.PlayerTeam) || free(sim.EnemyTeam)
+	}
+	return free(team)
+}
+
+// Options are the choices a lobby offers for creating and joining battles.
+type Options struct {
+	Modes        []string
+	Difficulties []string
+	Maps         []string
+	Tanks        []string
+}
+
+// CreateRequest sets up a new battle. Empty fields take the defaults.
+type CreateRequest struct {
+	Name       string
+	Mode       string
+	Difficulty string
+	Map        string
+}
+
+// JoinRequest picks a side and a tank.
+type JoinRequest struct {
+	Team  string // "player", "enemy" or empty for the side with fewer players
+	Class string // Empty keeps the tank's class
+}
+
+// Ticket is what a player joins a battle with.
+type Ticket struct {
+	Addr  string
+	Hello netplay.Hello
+}
+
+const (
+	// DefaultMaxBattles caps the battles a lobby hosts at once; each holds
+	// a socket and a whole simulation.
+	DefaultMaxBattles = 16
+	// DefaultIdleTimeout is how long a battle may go without a player
+	// connected before the lobby closes it.
+	DefaultIdleTimeout = 2 * time.Minute
+)
+
+// ErrTooManyBattles is returned by Service.Create when the lobby already
+// hosts MaxBattles.
+var ErrTooManyBattles = errors.New("too many battles; join one or try again later")
+
+// Service is the lobby. It serves HTTP:
+//
+//	GET  /options            Options
+//	GET  /battles            []Battle
+//	POST /battles            CreateRequest -> Battle
+//	POST /battles/{id}/join  JoinRequest -> Ticket
+type Service struct {
+	config  sim.Config // Template for new battles
+	classes map[string]sim.TankClass
+	mapsDir string
+	host    string // Address game servers listen on, without the port
+
+	// Logf reports battles starting and ending and the clients of their
+	// servers; nil is silent.
+	Logf func(format string, args ...any)
+
+	// MaxBattles caps the battles hosted at once, and IdleTimeout closes
+	// battles nobody has been connected to for that long. Set them before
+	// serving.
+	MaxBattles  int
+	IdleTimeout time.Duration
+
+	mu       sync.Mutex
+	battles  map[int]*battle
+	starting int // Battles being created, which count towards MaxBattles
+	nextID   int
+	closed   bool
+}
+
+type battle struct {
+	Battle
+	server *netplay.Server
+}
+
+// New starts a lobby that creates battles from cfg, on maps from mapsDir,
+// with game servers listening on host (such as "127.0.0.1").
+func New(cfg sim.Config, classes map[string]sim.TankClass, mapsDir, host string) *Service {
+	return &Service{
+		config:  cfg,
+		classes: classes,
+		mapsDir: mapsDir,
+		host:    host,
+		battles: make(map[int]*battle),
+		nextID:  1,
+
+		MaxBattles:  DefaultMaxBattles,
+		IdleTimeout: DefaultIdleTimeout,
+	}
+}
+
+func (s *Service) logf(format string, args ...any) {
+	if s.Logf != nil {
+		s.Logf(format, args...)
+	}
+}
+
+// Close shuts down every battle's game server.
+func (s *Service) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	for _, b := range s.battles {
+		b.server.Close()
+	}
+}
+
+// Options returns what battles can be created and joined with.
+func (s *Service) Options() Options {
+	return Options{
+		Modes:        keys(sim.BattleModes),
+		Difficulties: keys(sim.AIProfiles),
+		Maps:         s.maps(),
+		Tanks:        keys(s.classes),
+	}
+}
+
+func keys[V any](m map[string]V) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// maps lists the map files in the maps directory by name.
+func (s *Service) maps() []string {
+	paths, _ := filepath.Glob(filepath.Join(s.mapsDir, "*.json"))
+	names := make([]string, len(paths))
+	for i, path := range paths {
+		names[i] = strings.TrimSuffix(filepath.Base(path), ".json")
+	}
+	return names
+}
+
+// Battles lists the battles still going, oldest first.
+func (s *Service) Battles() []Battle {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list := make([]Battle, 0, len(s.battles))
+	for _, b := range s.battles {
+		list = append(list, b.listing())
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list
+}
+
+func (b *battle) listing() Battle {
+	listing := b.Battle
+	listing.Status = b.server.Status()
+	return listing
+}
+
+// Create starts a game server for a new battle. It waits for its first
+// player before the countdown begins, and leaves the list once the match
+// is over or nobody has played it for IdleTimeout.
+func (s *Service) Create(req CreateRequest) (Battle, error) {
+	cfg := s.config
+	cfg.Seed = sim.NewSeed()
+	if req.Mode != "" {
+		cfg.Mode = req.Mode
+	}
+	if req.Difficulty != "" {
+		cfg.Difficulty = req.Difficulty
+	}
+	if _, ok := sim.BattleModes[cfg.Mode]; !ok {
+		return Battle{}, fmt.Errorf("unknown battle mode %q", cfg.Mode)
+	}
+	if _, ok := sim.AIProfiles[cfg.Difficulty]; !ok {
+		return Battle{}, fmt.Errorf("unknown difficulty %q", cfg.Difficulty)
+	}
+	if req.Map != "" {
+		// Only maps from the directory, by name
+		if req.Map != filepath.Base(req.Map) {
+			return Battle{}, fmt.Errorf("unknown map %q", req.Map)
+		}
+		m, err := sim.LoadMap(filepath.Join(s.mapsDir, req.Map+".json"))
+		if errors.Is(err, os.ErrNotExist) {
+			return Battle{}, fmt.Errorf("unknown map %q", req.Map)
+		} else if err != nil {
+			return Battle{}, fmt.Errorf("loading map %s: %v", req.Map, err)
+		}
+		cfg.Map = m
+	}
+
+	// Hold a place before opening the socket, so a burst of requests
+	// can't overshoot the cap
+	s.mu.Lock()
+	if len(s.battles)+s.starting >= s.MaxBattles {
+		s.mu.Unlock()
+		return Battle{}, ErrTooManyBattles
+	}
+	s.starting++
+	s.mu.Unlock()
+
+	server, err := netplay.Listen(s.host+":0", cfg, s.classes, netplay.Conditions{})
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.starting--
+	if err != nil {
+		return Battle{}, err
+	}
+	if s.closed {
+		server.Close()
+		return Battle{}, errors.New("lobby closed")
+	}
+	server.IdleTimeout = s.IdleTimeout
+	b := &battle{
+		Battle: Battle{
+			ID:         s.nextID,
+			Name:       req.Name,
+			Mode:       cfg.Mode,
+			Difficulty: cfg.Difficulty,
+			Map:        req.Map,
+			Addr:       server.Addr().String(),
+		},
+		server: server,
+	}
+	if b.Name == "" {
+		b.Name = fmt.Sprintf("Battle %d", b.ID)
+	}
+	s.nextID++
+	s.battles[b.ID] = b
+
+	prefix := fmt.Sprintf("battle %d: ", b.ID)
+	server.Logf = func(format string, args ...any) { s.logf(prefix+format, args...) }
+	go s.run(b)
+
+	s.logf("battle %d (%s, %s) hosted on %s", b.ID, b.Name, b.Mode, b.Addr)
+	return b.listing(), nil
+}
+
+func (s *Service) run(b *battle) {
+	err := b.server.Run()
+
+	s.mu.Lock()
+	delete(s.battles, b.ID)
+	s.mu.Unlock()
+
+	switch {
+	case errors.Is(err, netplay.ErrIdle):
+		s.logf("battle %d closed with nobody playing", b.ID)
+	case err != nil:
+		s.logf("battle %d failed: %v", b.ID, err)
+	default:
+		s.logf("battle %d over", b.ID)
+	}
+}
+
+// Join checks a battle has room on the team asked for and returns what
+// to connect to it with. The game server has the final say on the tank.
+func (s *Service) Join(id int, req JoinRequest) (Ticket, error) {
+	s.mu.Lock()
+	b, ok := s.battles[id]
+	s.mu.Unlock()
+	if !ok {
+		return Ticket{}, fmt.Errorf("no battle %d", id)
+	}
+
+	hello := netplay.Hello{Team: netplay.AnyTeam, Class: req.Class}
+	switch req.Team {
+	case "":
+	case sim.PlayerTeam.String():
+		hello.Team = sim.PlayerTeam
+	case sim.EnemyTeam.String():
+		hello.Team = sim.EnemyTeam
+	default:
+		return Ticket{}, fmt.Errorf("unknown team %q", req.Team)
+	}
+	if req.Class != "" {
+		if _, err := sim.FindTankClass(s.classes, req.Class); err != nil {
+			return Ticket{}, err
+		}
+	}
+	if !b.listing().Open(hello.Team) {
+		return Ticket{}, fmt.Errorf("battle %d is full", id)
+	}
+	return Ticket{Addr: b.Addr, Hello: hello}, nil
+}
+
+func (s *Service) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(r.URL.Path, "/")
+	switch {
+	case path == "options" && r.Method == http.MethodGet:
+		reply(w, s.Options(), nil)
+	case path == "battles" && r.Method == http.MethodGet:
+		reply(w, s.Battles(), nil)
+	case path == "battles" && r.Method == http.MethodPost:
+		var req CreateRequest
+		if !decode(w, r, &req) {
+			return
+		}
+		battle, err := s.Create(req)
+		reply(w, battle, err)
+	case strings.HasPrefix(path, "battles/") && strings.HasSuffix(path, "/join") && r.Method == http.MethodPost:
+		id, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(path, "battles/"), "/join"))
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		var req JoinRequest
+		if !decode(w, r, &req) {
+			return
+		}
+		ticket, err := s.Join(id, req)
+		reply(w, ticket, err)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func decode(w http.ResponseWriter, r *http.Request, v any) bool {
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(v); err != nil {
+		http.Error(w, "bad request: "+err.Error(), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// reply sends v as JSON, or err as plain text. Refusals are conflicts,
+// apart from a lobby with no room for another battle.
+func reply(w http.ResponseWriter, v any, err error) {
+	switch {
+	case errors.Is(err, ErrTooManyBattles):
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
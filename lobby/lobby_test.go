@@ -0,0 +1,280 @@
+package lobby
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"tanks3d/netplay"
+	"tanks3d/sim"
+)
+
+// startLobby serves a lobby on localhost with the game's tank classes and
+// maps, returning it and a client for it.
+func startLobby(t *testing.T) (*Service, *Client) {
+	t.Helper()
+	classes, err := sim.LoadTankClasses("../data/tanks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := sim.Config{Mode: "skirmish", Difficulty: "normal", Countdown: sim.DefaultCountdown}
+	service := New(cfg, classes, "../data/maps", "127.0.0.1")
+	ts := httptest.NewServer(service)
+	t.Cleanup(func() {
+		ts.Close()
+		service.Close()
+	})
+	return service, NewClient(ts.URL)
+}
+
+// waitGone waits for a battle to leave the list.
+func waitGone(t *testing.T, client *Client, id int, within time.Duration) {
+	t.Helper()
+	for deadline := time.Now().Add(within); time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+		battles, err := client.Battles()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !listed(battles, id) {
+			return
+		}
+	}
+	t.Fatalf("battle %d still listed after %v", id, within)
+}
+
+// keepPlaying runs a connected player for a while, so the server hears
+// from them and their copy of the match catches up.
+func keepPlaying(t *testing.T, player *netplay.Client, d time.Duration) {
+	t.Helper()
+	for deadline := time.Now().Add(d); time.Now().Before(deadline); time.Sleep(time.Second / sim.TickRate) {
+		if _, err := player.Update(1.0/sim.TickRate, sim.Input{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func listed(battles []Battle, id int) bool {
+	for _, b := range battles {
+		if b.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+func TestOptions(t *testing.T) {
+	_, client := startLobby(t)
+	options, err := client.Options()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []struct {
+		list []string
+		item string
+	}{
+		{options.Modes, "7v7"},
+		{options.Difficulties, "normal"},
+		{options.Maps, "crossroads"},
+		{options.Tanks, "heavy"},
+	} {
+		if !contains(want.list, want.item) {
+			t.Errorf("options %v are missing %q", want.list, want.item)
+		}
+	}
+}
+
+func contains(list []string, item string) bool {
+	for _, s := range list {
+		if s == item {
+			return true
+		}
+	}
+	return false
+}
+
+func TestCreateAndList(t *testing.T) {
+	_, client := startLobby(t)
+
+	first, err := client.Create(CreateRequest{Name: "Dunes", Mode: "7v7", Difficulty: "hard"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := client.Create(CreateRequest{Map: "crossroads"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Name != "Dunes" || first.Mode != "7v7" || first.Difficulty != "hard" {
+		t.Errorf("created %+v, want the name, mode and difficulty asked for", first)
+	}
+	if second.Name != "Battle 2" || second.Mode != "skirmish" || second.Map != "crossroads" {
+		t.Errorf("created %+v, want the defaults on crossroads", second)
+	}
+	if first.Phase != sim.MatchCountdown || first.Players != [2]int{} || !first.Open(netplay.AnyTeam) {
+		t.Errorf("new battle is %v with %v players, want an open countdown with none", first.Phase, first.Players)
+	}
+
+	battles, err := client.Battles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(battles) != 2 || battles[0].ID != first.ID || battles[1].ID != second.ID {
+		t.Fatalf("listed %+v, want both battles oldest first", battles)
+	}
+}
+
+func TestCreateRefused(t *testing.T) {
+	_, client := startLobby(t)
+	tests := []struct {
+		name string
+		req  CreateRequest
+		want string
+	}{
+		{"mode", CreateRequest{Mode: "1v99"}, "unknown battle mode"},
+		{"difficulty", CreateRequest{Difficulty: "impossible"}, "unknown difficulty"},
+		{"map", CreateRequest{Map: "atlantis"}, "unknown map"},
+		{"map path", CreateRequest{Map: "../maps/crossroads"}, "unknown map"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := client.Create(tt.req)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestJoin(t *testing.T) {
+	_, client := startLobby(t)
+	battle, err := client.Create(CreateRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name string
+		id   int
+		req  JoinRequest
+		want string
+	}{
+		{"missing battle", battle.ID + 1, JoinRequest{}, "no battle"},
+		{"team", battle.ID, JoinRequest{Team: "spectators"}, "unknown team"},
+		{"class", battle.ID, JoinRequest{Class: "hovercraft"}, "hovercraft"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := client.Join(tt.id, tt.req)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got %v, want %q", err, tt.want)
+			}
+		})
+	}
+
+	ticket, err := client.Join(battle.ID, JoinRequest{Team: "player", Class: "heavy"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ticket.Addr != battle.Addr || ticket.Hello.Team != sim.PlayerTeam || ticket.Hello.Class != "heavy" {
+		t.Fatalf("got ticket %+v, want the battle's address with the team and class asked for", ticket)
+	}
+	player, err := netplay.Dial(ticket.Addr, ticket.Hello, netplay.Conditions{}, 3*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer player.Close()
+	keepPlaying(t, player, 200*time.Millisecond)
+	if tank := player.Tank(); tank.Team != sim.PlayerTeam || tank.Class != "heavy" {
+		t.Errorf("joined in a %s tank on the %v team, want a heavy on the player team", tank.Class, tank.Team)
+	}
+
+	// Skirmish has one tank on the player team, now taken
+	battles, err := client.Battles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(battles) != 1 || battles[0].Players != [2]int{1, 0} {
+		t.Fatalf("listed %+v, want one battle with a player on the player team", battles)
+	}
+	if _, err := client.Join(battle.ID, JoinRequest{Team: "player"}); err == nil || !strings.Contains(err.Error(), "full") {
+		t.Errorf("joining the full player team got %v, want it refused", err)
+	}
+}
+
+func TestMaxBattles(t *testing.T) {
+	service, client := startLobby(t)
+	service.MaxBattles = 2
+
+	var ids []int
+	for i := 0; i < 2; i++ {
+		battle, err := client.Create(CreateRequest{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, battle.ID)
+	}
+	if _, err := client.Create(CreateRequest{}); err == nil || !strings.Contains(err.Error(), "too many battles") {
+		t.Fatalf("third battle got %v, want it refused", err)
+	}
+
+	// Room opens up again once a battle ends
+	service.mu.Lock()
+	service.battles[ids[0]].server.Close()
+	service.mu.Unlock()
+	waitGone(t, client, ids[0], 2*time.Second)
+	if _, err := client.Create(CreateRequest{}); err != nil {
+		t.Errorf("creating after a battle ended: %v", err)
+	}
+}
+
+func TestMaxBattlesStatus(t *testing.T) {
+	service, _ := startLobby(t)
+	service.MaxBattles = 0
+
+	w := httptest.NewRecorder()
+	service.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/battles", strings.NewReader("{}")))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("got status %d, want %d", w.Code, http.StatusServiceUnavailable)
+	}
+}
+
+func TestIdleBattlesExpire(t *testing.T) {
+	service, client := startLobby(t)
+	service.IdleTimeout = 200 * time.Millisecond
+
+	t.Run("unjoined", func(t *testing.T) {
+		battle, err := client.Create(CreateRequest{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		waitGone(t, client, battle.ID, 2*time.Second)
+	})
+
+	t.Run("left", func(t *testing.T) {
+		battle, err := client.Create(CreateRequest{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ticket, err := client.Join(battle.ID, JoinRequest{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		player, err := netplay.Dial(ticket.Addr, ticket.Hello, netplay.Conditions{}, 3*time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Stays up while played, keeping the connection alive
+		keepPlaying(t, player, 3*service.IdleTimeout)
+		battles, err := client.Battles()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !listed(battles, battle.ID) {
+			t.Fatal("battle closed while a player was in it")
+		}
+
+		player.Close()
+		waitGone(t, client, battle.ID, 2*time.Second)
+	})
+}
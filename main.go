@@ -1,27 +1,166 @@
 package main
 
 import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
 	"tanks3d/game3d"
+	"tanks3d/internal/matchflags"
+	"tanks3d/lobby"
+	"tanks3d/netplay"
+	"tanks3d/sim"
 
 	rl "github.com/gen2brain/raylib-go/raylib"
 )
 
 func main() {
+	match := matchflags.Register(flag.CommandLine, matchflags.Battle, "skirmish")
+	recordPath := flag.String("record", "", "record the match to this replay file")
+	replayPath := flag.String("replay", "", "play back a replay file instead of reading input")
+	editPath := flag.String("edit", "", "open this map file in the map editor, creating it if it doesn't exist")
+	connect := flag.String("connect", "", "join the match on this tankserver address instead of playing locally")
+	team := flag.String("team", "", "team to join with --connect: player or enemy (default: whichever has fewer players)")
+	lobbyURL := flag.String("lobby", "", "browse and join networked battles on this lobby, such as http://localhost:8080")
+	var network netplay.Conditions
+	flag.DurationVar(&network.Latency, "lag", 0, "with --connect or --lobby, delay every packet each way by this much to test prediction")
+	flag.DurationVar(&network.Jitter, "jitter", 0, "with --connect or --lobby, add up to this much random delay to every packet")
+	flag.Float64Var(&network.Loss, "loss", 0, "with --connect or --lobby, drop this share of packets (0 to 1)")
+	flag.Parse()
+
+	if *connect != "" && *lobbyURL != "" {
+		log.Fatal("--connect and --lobby can't be used together; the lobby picks the server")
+	}
+
+	// Join a networked match before opening the window, so a server that
+	// isn't there is reported on the console
+	var client *netplay.Client
+	if *connect != "" {
+		hello, err := joinRequest(*team, match.PlayerClass)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if !network.Ideal() {
+			log.Printf("simulating %v", network)
+		}
+		if client, err = netplay.Dial(*connect, hello, network, 10*time.Second); err != nil {
+			log.Fatalf("connecting to %s: %v", *connect, err)
+		}
+		defer client.Close()
+	}
+
+	var replay *sim.Replay
+	if *replayPath != "" {
+		var err error
+		if replay, err = sim.LoadReplay(*replayPath); err != nil {
+			log.Fatalf("loading replay: %v", err)
+		}
+	}
+
+	var editing *sim.Map
+	if *editPath != "" {
+		var err error
+		if editing, err = openMap(*editPath, match.HeightmapPath); err != nil {
+			log.Fatalf("opening map: %v", err)
+		}
+	}
+
+	// A replay brings its own config
+	var cfg sim.Config
+	if replay == nil {
+		var err error
+		if cfg, _, err = match.Config(); err != nil {
+			log.Fatal(err)
+		}
+	}
+
 	// Initialize window
 	rl.InitWindow(1024, 768, "3D Tanks - World of Tanks Style")
 	defer rl.CloseWindow()
-	
+
 	rl.SetTargetFPS(60)
-	
-	// Disable cursor by default for mouse aiming
-	rl.DisableCursor()
-	
-	// Initialize game
-	game := game3d.NewGame()
-	
+
+	// Escape opens the pause menu instead of closing the window
+	rl.SetExitKey(rl.KeyNull)
+
+	// Start on the main menu, or straight into a replay or the map editor
+	var app *game3d.App
+	switch {
+	case replay != nil:
+		app = game3d.NewReplayApp(replay)
+	case editing != nil:
+		app = game3d.NewEditorApp(cfg, *editPath, editing)
+	case client != nil:
+		app = game3d.NewNetworkApp(cfg, client)
+	case *lobbyURL != "":
+		app = game3d.NewLobbyApp(cfg, lobby.NewClient(*lobbyURL), network)
+	default:
+		app = game3d.NewApp(cfg, *recordPath != "")
+	}
+
 	// Game loop
-	for !rl.WindowShouldClose() {
-		game.Update()
-		game.Draw()
+	for !rl.WindowShouldClose() && !app.Done() {
+		app.Update()
+		app.Draw()
+	}
+
+	// Only the last match played is kept
+	if recording := app.Recording(); recording != nil && *recordPath != "" {
+		if err := sim.SaveReplay(*recordPath, recording); err != nil {
+			log.Printf("saving replay: %v", err)
+		}
+	}
+}
+
+// joinRequest asks a server for a place on the named team, or either, in
+// the class given with --tank; without it the tank keeps the server's class.
+func joinRequest(team, class string) (netplay.Hello, error) {
+	hello := netplay.Hello{Team: netplay.AnyTeam}
+	switch team {
+	case "":
+	case sim.PlayerTeam.String():
+		hello.Team = sim.PlayerTeam
+	case sim.EnemyTeam.String():
+		hello.Team = sim.EnemyTeam
+	default:
+		return hello, fmt.Errorf("unknown team %q", team)
+	}
+
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "tank" {
+			hello.Class = class
+		}
+	})
+	return hello, nil
+}
+
+// openMap loads a map to edit, or starts a new one on the given heightmap
+// (flat if empty) when the file doesn't exist yet.
+func openMap(path, heightmapPath string) (*sim.Map, error) {
+	if _, err := os.Stat(path); err == nil {
+		if heightmapPath != "" {
+			return nil, fmt.Errorf("%s already exists; it keeps its own heightmap", path)
+		}
+		return sim.LoadMap(path)
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	var ground *sim.Heightmap
+	if heightmapPath != "" {
+		var err error
+		if ground, err = sim.LoadHeightmap(heightmapPath, sim.HillHeight); err != nil {
+			return nil, err
+		}
 	}
-}
\ No newline at end of file
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	m := sim.NewMap(name, ground)
+	m.HeightmapPath = heightmapPath
+	return m, nil
+}
@@ -0,0 +1,501 @@
+package netplay
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"time"
+
+	"tanks3d/sim"
+)
+
+// helloInterval is how often a joining client asks again while it waits
+// for the whole welcome.
+const helloInterval = 250 * time.Millisecond
+
+const (
+	// InterpolationDelay is how far behind the latest snapshot other tanks
+	// are shown, so there are two snapshots to move them between even when
+	// one is late or lost.
+	InterpolationDelay = 100 * time.Millisecond
+
+	// maxPending caps the inputs kept waiting for the server, should it
+	// stop acknowledging them.
+	maxPending = 2 * sim.TickRate
+
+	// snapshotHistory is how many snapshots are kept to interpolate
+	// between and for the server to send changes from. It is more than
+	// the server keeps, so any baseline it picks is still here.
+	snapshotHistory = 16
+)
+
+// ErrMatchOver is returned by Client.Poll once the server has said goodbye
+// after the match.
+var ErrMatchOver = errors.New("match over")
+
+// Client is a player's connection to a Server. It keeps a copy of the
+// match that follows the server's snapshots. The player's own tank, and
+// the copy's clock, run ahead of them on the player's input; the other
+// tanks are shown slightly in the past, moving smoothly between snapshots.
+type Client struct {
+	conn    net.PacketConn
+	server  net.Addr
+	world   *sim.Game
+	tanks   []*sim.Tank
+	tank    int
+	classes map[string]sim.TankClass
+	packets chan []byte
+	clock   sim.Clock
+
+	seq     uint64         // Sequence number of the latest input
+	pending []pendingInput // Inputs the server hasn't applied yet
+	view    int            // Server tick the other tanks were last drawn at
+
+	tick      int        // Tick of the latest snapshot applied
+	history   []snapshot // Recent snapshots, oldest first
+	bullets   []BulletState
+	destroyed int // Destructions applied so far
+	events    []sim.Event
+	lastHeard time.Time
+	err       error
+
+	stats Stats
+}
+
+// pendingInput is an input the player's tank has been moved by ahead of
+// the server.
+type pendingInput struct {
+	seq  uint64
+	sent time.Time
+	TickInput
+}
+
+// snapshot is a received Snapshot with the local time it arrived.
+type snapshot struct {
+	*Snapshot
+	received time.Time
+}
+
+// Stats describe how the connection is doing, for tuning prediction.
+type Stats struct {
+	RTT        time.Duration // Round trip from sending an input to seeing it applied
+	Pending    int           // Inputs not yet applied by the server
+	Correction float32       // How far the latest snapshot moved the player's tank from its prediction
+}
+
+// Dial joins the server at addr under the given network conditions,
+// giving up after timeout.
+func Dial(addr string, hello Hello, network Conditions, timeout time.Duration) (*Client, error) {
+	server, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenPacket("udp", ":0")
+	if err != nil {
+		return nil, err
+	}
+	conn = network.Wrap(conn)
+
+	c, err := join(conn, server, hello, timeout)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// join says hello until the server welcomes or rejects the client.
+func join(conn net.PacketConn, server net.Addr, hello Hello, timeout time.Duration) (*Client, error) {
+	deadline := time.Now().Add(timeout)
+	buf := make([]byte, maxPacket)
+	var chunks welcomeChunks
+
+	for time.Now().Before(deadline) {
+		if _, err := conn.WriteTo(appendHello(nil, hello), server); err != nil {
+			return nil, err
+		}
+
+		conn.SetReadDeadline(minTime(deadline, time.Now().Add(helloInterval)))
+		for {
+			n, from, err := conn.ReadFrom(buf)
+			if isTimeout(err) {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			if n == 0 || from.String() != server.String() {
+				continue
+			}
+
+			switch packetKind(buf[0]) {
+			case packetReject:
+				return nil, fmt.Errorf("server refused to join: %s", buf[1:n])
+			case packetWelcome:
+				complete, err := chunks.add(buf[1:n])
+				if err != nil {
+					return nil, err
+				}
+				if complete {
+					w, err := chunks.decode()
+					if err != nil {
+						return nil, fmt.Errorf("reading match setup: %w", err)
+					}
+					conn.SetReadDeadline(time.Time{})
+					return newClient(conn, server, w)
+				}
+			}
+		}
+	}
+	return nil, fmt.Errorf("no answer from %s", server)
+}
+
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
+
+func newClient(conn net.PacketConn, server net.Addr, w welcome) (*Client, error) {
+	world := sim.NewGame(w.Config)
+	tanks := world.Tanks()
+	if w.Tank < 0 || w.Tank >= len(tanks) {
+		return nil, fmt.Errorf("server gave us tank %d of %d", w.Tank, len(tanks))
+	}
+
+	c := &Client{
+		conn:      conn,
+		server:    server,
+		world:     world,
+		tanks:     tanks,
+		tank:      w.Tank,
+		classes:   w.Classes,
+		packets:   make(chan []byte, 256),
+		clock:     sim.NewClock(),
+		lastHeard: time.Now(),
+	}
+	go c.read()
+	return c, nil
+}
+
+// read passes datagrams from the server to Poll, dropping them if Poll
+// falls behind; snapshots supersede each other anyway.
+func (c *Client) read() {
+	buf := make([]byte, maxPacket)
+	for {
+		n, from, err := c.conn.ReadFrom(buf)
+		if err != nil {
+			close(c.packets)
+			return
+		}
+		if n == 0 || from.String() != c.server.String() {
+			continue
+		}
+		select {
+		case c.packets <- append([]byte(nil), buf[:n]...):
+		default:
+		}
+	}
+}
+
+// World returns the client's copy of the match.
+func (c *Client) World() *sim.Game {
+	return c.world
+}
+
+// Tank returns the player's tank in World.
+func (c *Client) Tank() *sim.Tank {
+	return c.tanks[c.tank]
+}
+
+// Stats returns the latest connection figures.
+func (c *Client) Stats() Stats {
+	c.stats.Pending = len(c.pending)
+	return c.stats
+}
+
+// Update runs the player's side of the match for realSeconds of wall time.
+// Each tick that covers moves the player's tank on in and queues in for
+// the server, like Game.Update does for a local match; then whatever the
+// server has sent is applied. It returns the number of ticks stepped.
+func (c *Client) Update(realSeconds float32, in sim.Input) (int, error) {
+	now := time.Now()
+	ticks := c.clock.Advance(realSeconds)
+	for i := 0; i < ticks; i++ {
+		c.seq++
+		c.pending = append(c.pending, pendingInput{seq: c.seq, sent: now, TickInput: TickInput{in, c.view}})
+		c.world.Predict(c.Tank(), in)
+		c.world.Clock.Tick++
+		in.Fire = false
+	}
+	if len(c.pending) > maxPending {
+		c.pending = c.pending[len(c.pending)-maxPending:]
+	}
+	if ticks > 0 && c.err == nil {
+		c.send()
+	}
+
+	err := c.Poll()
+	c.interpolate(now)
+	return ticks, err
+}
+
+// send repeats the latest unacknowledged inputs to the server.
+func (c *Client) send() {
+	pending := c.pending[max(0, len(c.pending)-maxInputsPerPacket):]
+	if len(pending) == 0 {
+		return
+	}
+	inputs := make([]TickInput, len(pending))
+	for i, p := range pending {
+		inputs[i] = p.TickInput
+	}
+	c.conn.WriteTo(appendInputs(nil, c.tick, pending[0].seq, inputs), c.server)
+}
+
+// Poll applies whatever the server has sent since the last call, without
+// waiting. It returns ErrMatchOver once the server has closed the match,
+// or an error if the server has gone quiet.
+func (c *Client) Poll() error {
+	if c.err != nil {
+		return c.err
+	}
+
+	var latest *Snapshot
+	var ack uint64
+	now := time.Now()
+	received := false
+	for drained := false; !drained; {
+		select {
+		case data, ok := <-c.packets:
+			if !ok {
+				c.err = net.ErrClosed
+				return c.err
+			}
+			received = true
+			if len(data) == 0 {
+				continue
+			}
+			switch packetKind(data[0]) {
+			case packetSnapshot:
+				snapshotAck, s, err := decodeSnapshot(data[1:], c.baseline)
+				// The tick stops once the match is over, but the acks go on
+				if err != nil || s.Tick < c.tick {
+					continue
+				}
+				// Take the events of every snapshot, but only the latest state
+				c.addEvents(s)
+				c.remember(snapshot{s, now})
+				if latest == nil || s.Tick >= latest.Tick {
+					latest, ack = s, snapshotAck
+				}
+			case packetBye:
+				c.err = ErrMatchOver
+			}
+		default:
+			drained = true
+		}
+	}
+
+	if received {
+		c.lastHeard = now
+	} else if now.Sub(c.lastHeard) > ClientTimeout {
+		// The goodbye can go missing; a finished match that has gone quiet
+		// is over all the same
+		if c.world.Over() {
+			c.err = ErrMatchOver
+		} else {
+			c.err = fmt.Errorf("lost connection to %s", c.server)
+		}
+	}
+	if latest != nil {
+		c.apply(latest, ack, now)
+	}
+	return c.err
+}
+
+func (c *Client) addEvents(s *Snapshot) {
+	for _, e := range s.Events {
+		c.events = append(c.events, e.event(s.Tick, c.tanks))
+	}
+}
+
+// baseline finds a snapshot received earlier, for the server to send
+// changes from.
+func (c *Client) baseline(tick int) *Snapshot {
+	for i := len(c.history) - 1; i >= 0; i-- {
+		if c.history[i].Tick == tick {
+			return c.history[i].Snapshot
+		}
+	}
+	return nil
+}
+
+// remember adds a snapshot to the interpolation history in tick order.
+func (c *Client) remember(s snapshot) {
+	i := len(c.history)
+	for i > 0 && c.history[i-1].Tick > s.Tick {
+		i--
+	}
+	c.history = append(c.history, snapshot{})
+	copy(c.history[i+1:], c.history[i:])
+	c.history[i] = s
+	if len(c.history) > snapshotHistory {
+		c.history = c.history[len(c.history)-snapshotHistory:]
+	}
+}
+
+// apply brings the copy of the match up to a snapshot, then replays the
+// player's inputs the server hadn't applied yet on top of it. When the
+// prediction was right the tank ends up where it already was; when the
+// server disagrees, this is where it is corrected.
+func (c *Client) apply(s *Snapshot, ack uint64, now time.Time) {
+	world := c.world
+	c.tick = s.Tick
+	world.Clock.Tick = s.Tick
+	world.Match = s.Match
+
+	player := c.Tank()
+	predicted := player.Position
+	for i, state := range s.Tanks {
+		if i >= len(c.tanks) {
+			break
+		}
+		t := c.tanks[i]
+		if state.Class != t.Class {
+			if class, err := sim.FindTankClass(c.classes, state.Class); err == nil {
+				world.Refit(t, class)
+			}
+		}
+		state.apply(t)
+	}
+
+	// Rewind the player's tank to the server's state and replay the rest
+	acked := 0
+	for acked < len(c.pending) && c.pending[acked].seq <= ack {
+		if c.pending[acked].seq == ack {
+			c.measure(now.Sub(c.pending[acked].sent))
+		}
+		acked++
+	}
+	c.pending = c.pending[acked:]
+	for _, p := range c.pending {
+		world.Predict(player, p.Input)
+		world.Clock.Tick++
+	}
+	c.stats.Correction = distance(predicted, player.Position)
+
+	c.bullets = s.Bullets
+
+	for i, progress := range s.Zones {
+		if i < len(world.Zones) {
+			world.Zones[i].Progress = progress
+		}
+	}
+
+	for _, d := range s.Destroyed[min(c.destroyed, len(s.Destroyed)):] {
+		world.DestroyObstacle(d.At, d.Direction)
+	}
+	c.destroyed = max(c.destroyed, len(s.Destroyed))
+}
+
+// measure folds a new round trip time into a smoothed average.
+func (c *Client) measure(rtt time.Duration) {
+	if c.stats.RTT == 0 {
+		c.stats.RTT = rtt
+		return
+	}
+	c.stats.RTT += (rtt - c.stats.RTT) / 8
+}
+
+// interpolate poses the other tanks and the shells as they were
+// InterpolationDelay behind the server, between the two snapshots around
+// that moment.
+func (c *Client) interpolate(now time.Time) {
+	if len(c.history) == 0 {
+		return
+	}
+	newest := c.history[len(c.history)-1]
+	render := float32(newest.Tick) + float32(now.Sub(newest.received).Seconds())*sim.TickRate -
+		float32(InterpolationDelay.Seconds())*sim.TickRate
+
+	from, to := c.history[0], newest
+	for i := len(c.history) - 1; i > 0; i-- {
+		if float32(c.history[i-1].Tick) <= render {
+			from, to = c.history[i-1], c.history[i]
+			break
+		}
+	}
+	c.view = int(math.Round(float64(render)))
+
+	fraction := float32(0)
+	if to.Tick > from.Tick {
+		fraction = clamp01((render - float32(from.Tick)) / float32(to.Tick-from.Tick))
+	}
+
+	for i, t := range c.tanks {
+		if i == c.tank || i >= len(from.Tanks) || i >= len(to.Tanks) {
+			continue
+		}
+		a, b := from.Tanks[i], to.Tanks[i]
+		t.Position = lerpVec(a.Position, b.Position, fraction)
+		t.Rotation = lerpAngle(a.Rotation, b.Rotation, fraction)
+		t.TurretRotation = lerpAngle(a.TurretRotation, b.TurretRotation, fraction)
+		t.GunElevation = lerp(a.GunElevation, b.GunElevation, fraction)
+		t.Pitch = lerp(a.Pitch, b.Pitch, fraction)
+		t.Roll = lerp(a.Roll, b.Roll, fraction)
+	}
+
+	// Shells fly on ballistic arcs, so wind them back along theirs
+	behind := max(0, float32(newest.Tick)-render)
+	c.world.Bullets = c.world.Bullets[:0]
+	for _, b := range c.bullets {
+		position := b.Position.Sub(b.Velocity.Scale(behind))
+		position.Y -= sim.Gravity * behind * behind / 2
+		c.world.Bullets = append(c.world.Bullets, &sim.Bullet{Position: position, Velocity: b.Velocity, Team: b.Team})
+	}
+}
+
+func lerp(a, b, f float32) float32 {
+	return a + (b-a)*f
+}
+
+func lerpVec(a, b sim.Vec3, f float32) sim.Vec3 {
+	return sim.NewVec3(lerp(a.X, b.X, f), lerp(a.Y, b.Y, f), lerp(a.Z, b.Z, f))
+}
+
+// lerpAngle turns the short way round from a to b.
+func lerpAngle(a, b, f float32) float32 {
+	delta := math.Remainder(float64(b-a), 2*math.Pi)
+	return a + float32(delta)*f
+}
+
+func clamp01(v float32) float32 {
+	return max(0, min(1, v))
+}
+
+func distance(a, b sim.Vec3) float32 {
+	d := a.Sub(b)
+	return float32(math.Sqrt(float64(d.X*d.X + d.Y*d.Y + d.Z*d.Z)))
+}
+
+// DrainEvents returns what happened since the last call: the events the
+// server reported and those raised by the copy of the match itself.
+func (c *Client) DrainEvents() []sim.Event {
+	events := append(c.events, c.world.DrainEvents()...)
+	c.events = nil
+	return events
+}
+
+// Close tells the server the player is leaving and hangs up.
+func (c *Client) Close() error {
+	c.conn.WriteTo([]byte{byte(packetBye)}, c.server)
+	return c.conn.Close()
+}
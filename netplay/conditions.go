@@ -0,0 +1,153 @@
+package netplay
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// Conditions are network faults to simulate, for trying out prediction and
+// interpolation on localhost.
+type Conditions struct {
+	Latency time.Duration // One-way delay added to every packet
+	Jitter  time.Duration // Random extra delay up to this much, which reorders packets
+	Loss    float64       // Share of packets dropped, from 0 to 1
+}
+
+// Ideal reports whether there is nothing to simulate.
+func (c Conditions) Ideal() bool {
+	return c.Latency <= 0 && c.Jitter <= 0 && c.Loss <= 0
+}
+
+func (c Conditions) String() string {
+	return fmt.Sprintf("latency %v, jitter %v, loss %.0f%%", c.Latency, c.Jitter, c.Loss*100)
+}
+
+// Wrap returns conn with the conditions applied to packets in both
+// directions, or conn itself when they are ideal.
+func (c Conditions) Wrap(conn net.PacketConn) net.PacketConn {
+	if c.Ideal() {
+		return conn
+	}
+	l := &laggyConn{
+		PacketConn: conn,
+		conditions: c,
+		rng:        rand.New(rand.NewSource(time.Now().UnixNano())),
+		incoming:   make(chan packet, 256),
+		errs:       make(chan error, 1),
+	}
+	go l.read()
+	return l
+}
+
+// laggyConn delays and drops packets on their way through a PacketConn.
+type laggyConn struct {
+	net.PacketConn
+	conditions Conditions
+
+	mu       sync.Mutex
+	rng      *rand.Rand
+	deadline time.Time
+	incoming chan packet
+	errs     chan error
+	writes   sync.WaitGroup // Delayed packets not sent yet
+}
+
+// fate decides whether a packet gets through and how late.
+func (l *laggyConn) fate() (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.rng.Float64() < l.conditions.Loss {
+		return 0, false
+	}
+	delay := l.conditions.Latency
+	if l.conditions.Jitter > 0 {
+		delay += time.Duration(l.rng.Int63n(int64(l.conditions.Jitter)))
+	}
+	return delay, true
+}
+
+func (l *laggyConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	delay, ok := l.fate()
+	if !ok {
+		return len(b), nil
+	}
+	data := append([]byte(nil), b...)
+	l.writes.Add(1)
+	time.AfterFunc(delay, func() {
+		defer l.writes.Done()
+		l.PacketConn.WriteTo(data, addr)
+	})
+	return len(b), nil
+}
+
+// Close lets the packets already written arrive before closing, as they
+// would have left a real connection by then.
+func (l *laggyConn) Close() error {
+	l.writes.Wait()
+	return l.PacketConn.Close()
+}
+
+func (l *laggyConn) read() {
+	buf := make([]byte, maxPacket)
+	for {
+		n, addr, err := l.PacketConn.ReadFrom(buf)
+		if err != nil {
+			l.errs <- err
+			return
+		}
+		delay, ok := l.fate()
+		if !ok {
+			continue
+		}
+		p := packet{addr, append([]byte(nil), buf[:n]...)}
+		time.AfterFunc(delay, func() {
+			select {
+			case l.incoming <- p:
+			default:
+			}
+		})
+	}
+}
+
+// ReadFrom returns the next packet whose delay is up.
+func (l *laggyConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	l.mu.Lock()
+	deadline := l.deadline
+	l.mu.Unlock()
+
+	var expired <-chan time.Time
+	if !deadline.IsZero() {
+		timer := time.NewTimer(time.Until(deadline))
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	select {
+	case p := <-l.incoming:
+		return copy(b, p.data), p.addr, nil
+	case err := <-l.errs:
+		l.errs <- err
+		return 0, nil, err
+	case <-expired:
+		return 0, nil, os.ErrDeadlineExceeded
+	}
+}
+
+// SetReadDeadline applies to the delayed packets; the underlying
+// connection keeps reading without a deadline.
+func (l *laggyConn) SetReadDeadline(t time.Time) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.deadline = t
+	return nil
+}
+
+func (l *laggyConn) SetDeadline(t time.Time) error {
+	l.SetReadDeadline(t)
+	return l.PacketConn.SetWriteDeadline(t)
+}
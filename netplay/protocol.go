@@ -0,0 +1,215 @@
+// Package netplay plays matches over UDP. A Server runs the authoritative
+// simulation and streams snapshots of it; each Client sends its player's
+// input and mirrors the snapshots into a local sim.Game for the frontend.
+package netplay
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"tanks3d/sim"
+)
+
+// ProtocolVersion is sent in every hello; servers turn away clients that
+// speak another version.
+const ProtocolVersion = 4
+
+const (
+	// SnapshotInterval is the number of ticks between snapshots.
+	SnapshotInterval = 2
+	// ClientTimeout is how long either side waits without hearing from the
+	// other before giving up on it.
+	ClientTimeout = 5 * time.Second
+
+	maxPacket    = 64 * 1024
+	welcomeChunk = 1024 // Bytes of match setup per welcome packet
+
+	// maxInputsPerPacket is how many of its unacknowledged inputs a client
+	// repeats in each packet, so a lost packet costs nothing.
+	maxInputsPerPacket = 32
+)
+
+// AnyTeam asks the server for a place on whichever team has fewer players.
+const AnyTeam sim.Team = -1
+
+// packetKind is the first byte of every datagram.
+type packetKind byte
+
+const (
+	packetHello    packetKind = iota + 1 // Client asks to join
+	packetWelcome                        // One chunk of the match setup
+	packetReject                         // Join refused, with a reason
+	packetInput                          // A client's input for recent ticks
+	packetSnapshot                       // State of the match
+	packetBye                            // Either side is leaving
+)
+
+// Hello is what a client asks for when it joins.
+type Hello struct {
+	Team  sim.Team // AnyTeam to be placed on the smaller side
+	Class string   // Tank class to refit to during the countdown; empty keeps the tank's
+}
+
+func appendHello(b []byte, h Hello) []byte {
+	team := byte(255)
+	if h.Team != AnyTeam {
+		team = byte(h.Team)
+	}
+	b = append(b, byte(packetHello), ProtocolVersion, team)
+	return append(b, h.Class...)
+}
+
+func decodeHello(b []byte) (Hello, error) {
+	if len(b) < 2 {
+		return Hello{}, errors.New("short hello")
+	}
+	if b[0] != ProtocolVersion {
+		return Hello{}, fmt.Errorf("protocol version %d, want %d", b[0], ProtocolVersion)
+	}
+	h := Hello{Team: sim.Team(b[1]), Class: string(b[2:])}
+	if b[1] == 255 {
+		h.Team = AnyTeam
+	} else if h.Team != sim.PlayerTeam && h.Team != sim.EnemyTeam {
+		return Hello{}, fmt.Errorf("unknown team %d", b[1])
+	}
+	return h, nil
+}
+
+// welcome is the match setup a joining client builds its copy of the game
+// from. It is too big for one datagram, so it travels compressed in chunks.
+type welcome struct {
+	Tank    int // Index into Game.Tanks of the client's tank
+	Config  sim.Config
+	Classes map[string]sim.TankClass // For tanks refitted on the server
+}
+
+func welcomePackets(w welcome) ([][]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if err := json.NewEncoder(zw).Encode(w); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	data := buf.Bytes()
+	count := (len(data) + welcomeChunk - 1) / welcomeChunk
+	packets := make([][]byte, 0, count)
+	for i := 0; i < count; i++ {
+		chunk := data[i*welcomeChunk : min(len(data), (i+1)*welcomeChunk)]
+		p := []byte{byte(packetWelcome)}
+		p = binary.AppendUvarint(p, uint64(i))
+		p = binary.AppendUvarint(p, uint64(count))
+		packets = append(packets, append(p, chunk...))
+	}
+	return packets, nil
+}
+
+// welcomeChunks collects the chunks of a welcome as they arrive, in any
+// order.
+type welcomeChunks struct {
+	chunks   [][]byte
+	received int
+}
+
+// add stores one chunk and reports whether the welcome is complete.
+func (w *welcomeChunks) add(b []byte) (bool, error) {
+	index, n := binary.Uvarint(b)
+	if n <= 0 {
+		return false, errors.New("bad welcome chunk")
+	}
+	count, m := binary.Uvarint(b[n:])
+	if m <= 0 || count == 0 || index >= count || count > maxPacket {
+		return false, errors.New("bad welcome chunk")
+	}
+	if w.chunks == nil {
+		w.chunks = make([][]byte, count)
+	} else if uint64(len(w.chunks)) != count {
+		return false, errors.New("welcome chunk count changed")
+	}
+	if w.chunks[index] == nil {
+		w.chunks[index] = append([]byte(nil), b[n+m:]...)
+		w.received++
+	}
+	return w.received == len(w.chunks), nil
+}
+
+func (w *welcomeChunks) decode() (welcome, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(bytes.Join(w.chunks, nil)))
+	if err != nil {
+		return welcome{}, err
+	}
+	var out welcome
+	if err := json.NewDecoder(zr).Decode(&out); err != nil {
+		return welcome{}, err
+	}
+	_, err = io.Copy(io.Discard, zr)
+	return out, err
+}
+
+// TickInput is a client's input for one tick, with the tick of the match
+// the player was looking at when they gave it. The server rewinds targets
+// to that view when the shot lands.
+type TickInput struct {
+	Input sim.Input
+	View  int
+}
+
+// appendInputs encodes a run of a client's per-tick inputs, numbered from
+// first, after the tick of the latest snapshot the client has, which the
+// server sends the next ones as changes from. Views are sent as the
+// change from the one before.
+func appendInputs(b []byte, snapshot int, first uint64, inputs []TickInput) []byte {
+	b = append(b, byte(packetInput))
+	b = binary.AppendUvarint(b, uint64(snapshot))
+	b = binary.AppendUvarint(b, first)
+	b = binary.AppendUvarint(b, uint64(len(inputs)))
+	view := 0
+	for _, in := range inputs {
+		b = sim.AppendInput(b, in.Input)
+		b = binary.AppendVarint(b, int64(in.View-view))
+		view = in.View
+	}
+	return b
+}
+
+func decodeInputs(b []byte) (snapshot int, first uint64, inputs []TickInput, err error) {
+	tick, k := binary.Uvarint(b)
+	if k <= 0 {
+		return 0, 0, nil, errors.New("bad snapshot tick")
+	}
+	b = b[k:]
+	first, n := binary.Uvarint(b)
+	if n <= 0 {
+		return 0, 0, nil, errors.New("bad input sequence")
+	}
+	count, m := binary.Uvarint(b[n:])
+	if m <= 0 || count > maxInputsPerPacket {
+		return 0, 0, nil, errors.New("bad input count")
+	}
+	b = b[n+m:]
+	inputs = make([]TickInput, count)
+	view := 0
+	for i := range inputs {
+		var size int
+		if inputs[i].Input, size, err = sim.DecodeInput(b); err != nil {
+			return 0, 0, nil, err
+		}
+		b = b[size:]
+		delta, size := binary.Varint(b)
+		if size <= 0 {
+			return 0, 0, nil, errors.New("bad input view")
+		}
+		b = b[size:]
+		view += int(delta)
+		inputs[i].View = view
+	}
+	return int(tick), first, inputs, nil
+}
@@ -0,0 +1,494 @@
+package netplay
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"tanks3d/sim"
+)
+
+// Linger is how long a server keeps sending the final state after the
+// match ends, so every client sees the result, before it says goodbye.
+const Linger = 3 * time.Second
+
+// Server runs a match for the clients connected to it. Every tank starts
+// under AI control; a joining client takes over one, and it goes back to
+// the AI if they leave or time out.
+type Server struct {
+	conn    net.PacketConn
+	game    *sim.Game
+	tanks   []*sim.Tank
+	ids     map[*sim.Tank]int
+	classes map[string]sim.TankClass
+	config  sim.Config
+	clients map[string]*client // By address
+
+	ticks     int // Ticks stepped, including those after the match ended
+	destroyed []Destruction
+	events    []EventState
+	sent      []*Snapshot // The latest snapshots, oldest first, to send changes from
+
+	// Logf reports clients coming and going; nil is silent.
+	Logf func(format string, args ...any)
+
+	// IdleTimeout ends Run once nobody has been connected for this long,
+	// whether nobody joined or everyone left. Zero waits forever.
+	IdleTimeout time.Duration
+
+	mu     sync.Mutex // Guards status, which is read from other goroutines
+	status Status
+}
+
+// Status sums up a server's match for a lobby listing it.
+type Status struct {
+	Phase   sim.MatchPhase
+	Players [2]int // Clients on each team, indexed by sim.Team
+	Tanks   [2]int // Tanks on each team, living or not
+}
+
+// Status returns how the match stood at the last tick, or the last time
+// a client came or went. It is safe to call while Run is going.
+func (s *Server) Status() Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.status
+}
+
+// publish updates the status other goroutines see.
+func (s *Server) publish() {
+	status := Status{Phase: s.game.Match.Phase}
+	for _, t := range s.tanks {
+		status.Tanks[t.Team]++
+	}
+	for _, c := range s.clients {
+		status.Players[s.tanks[c.tank].Team]++
+	}
+	s.mu.Lock()
+	s.status = status
+	s.mu.Unlock()
+}
+
+// maxQueuedInputs is how far a client's inputs may run ahead of the
+// server before the oldest are dropped to catch up. A few ticks absorb
+// jitter without adding much lag.
+const maxQueuedInputs = 4
+
+// baselineSnapshots is how many recent snapshots the server can send
+// changes from. A client that hasn't confirmed any of them, after a long
+// stall, gets the next one in full.
+const baselineSnapshots = 12
+
+// client is a player connected to the server.
+type client struct {
+	addr      net.Addr
+	tank      int
+	ai        sim.Controller // What drove the tank before they took it over
+	control   *remoteInput
+	welcome   [][]byte
+	queue     []queuedInput // Inputs received but not yet applied
+	received  uint64        // Latest input sequence number received
+	ack       uint64        // Latest input sequence number applied
+	snapshot  int           // Tick of the latest snapshot the client has
+	lastHeard time.Time
+}
+
+type queuedInput struct {
+	seq uint64
+	TickInput
+}
+
+// remoteInput drives a tank with one input its client sent per tick.
+type remoteInput struct {
+	input sim.Input
+}
+
+func (r *remoteInput) Control(*sim.Game, *sim.Tank) sim.Input {
+	return r.input
+}
+
+// nextInput hands the tank the client's next input for the coming tick.
+// If none has arrived the tank carries on with the last one, without
+// firing again. The tank's Latency follows how far behind the player sees.
+func (c *client) nextInput(t *sim.Tank, tick int) {
+	for len(c.queue) > maxQueuedInputs {
+		// Don't lose shots with the inputs skipped
+		c.queue[1].Input.Fire = c.queue[1].Input.Fire || c.queue[0].Input.Fire
+		c.queue = c.queue[1:]
+	}
+	if len(c.queue) == 0 {
+		c.control.input.Fire = false
+		return
+	}
+	c.control.input = c.queue[0].Input
+	c.ack = c.queue[0].seq
+	t.Latency = max(0, tick-c.queue[0].View)
+	c.queue = c.queue[1:]
+}
+
+// Listen starts a server for a match from cfg on a UDP address such as
+// ":7777", under the given network conditions. classes are the tank
+// classes clients may pick.
+func Listen(addr string, cfg sim.Config, classes map[string]sim.TankClass, network Conditions) (*Server, error) {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return NewServer(network.Wrap(conn), cfg, classes), nil
+}
+
+// NewServer serves a match from cfg on conn.
+func NewServer(conn net.PacketConn, cfg sim.Config, classes map[string]sim.TankClass) *Server {
+	cfg.PlayerAI = true
+	game := sim.NewGame(cfg)
+	tanks := game.Tanks()
+	ids := make(map[*sim.Tank]int, len(tanks))
+	for i, t := range tanks {
+		ids[t] = i
+	}
+
+	s := &Server{
+		conn:    conn,
+		game:    game,
+		tanks:   tanks,
+		ids:     ids,
+		classes: classes,
+		config:  cfg,
+		clients: make(map[string]*client),
+	}
+	s.publish()
+	return s
+}
+
+// Addr returns the address the server listens on.
+func (s *Server) Addr() net.Addr {
+	return s.conn.LocalAddr()
+}
+
+// Close stops the server; Run returns once it notices.
+func (s *Server) Close() error {
+	return s.conn.Close()
+}
+
+type packet struct {
+	addr net.Addr
+	data []byte
+}
+
+// ErrIdle is returned by Server.Run when it gives up on a match nobody is
+// playing.
+var ErrIdle = errors.New("no players")
+
+// Run steps the match in real time and talks to clients until the match
+// has ended and lingered, the server is closed, or it has sat empty for
+// IdleTimeout. The match waits at the start until the first client joins.
+func (s *Server) Run() error {
+	defer s.conn.Close()
+
+	packets := make(chan packet, 256)
+	errs := make(chan error, 1)
+	done := make(chan struct{})
+	defer close(done)
+	go s.read(packets, errs, done)
+
+	ticker := time.NewTicker(time.Second / sim.TickRate)
+	defer ticker.Stop()
+
+	var lingered int
+	occupied := time.Now() // Last time anyone was connected
+	for {
+		select {
+		case p := <-packets:
+			s.handle(p, time.Now())
+		case err := <-errs:
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		case now := <-ticker.C:
+			s.dropSilent(now)
+			if len(s.clients) > 0 {
+				occupied = now
+			} else if s.IdleTimeout > 0 && now.Sub(occupied) > s.IdleTimeout {
+				s.logf("nobody connected for %v; closing", s.IdleTimeout)
+				return ErrIdle
+			}
+			if s.ticks == 0 && len(s.clients) == 0 {
+				continue
+			}
+			s.step()
+			if s.game.Over() {
+				lingered++
+				if lingered >= sim.Ticks(Linger) {
+					s.broadcast([]byte{byte(packetBye)})
+					return nil
+				}
+			}
+		}
+	}
+}
+
+func (s *Server) read(packets chan<- packet, errs chan<- error, done <-chan struct{}) {
+	buf := make([]byte, maxPacket)
+	for {
+		n, addr, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			errs <- err
+			return
+		}
+		select {
+		case packets <- packet{addr, append([]byte(nil), buf[:n]...)}:
+		case <-done:
+			return
+		}
+	}
+}
+
+func (s *Server) logf(format string, args ...any) {
+	if s.Logf != nil {
+		s.Logf(format, args...)
+	}
+}
+
+// handle acts on one datagram from a client. Anything malformed is
+// dropped; the client will send again.
+func (s *Server) handle(p packet, now time.Time) {
+	if len(p.data) == 0 {
+		return
+	}
+	c := s.clients[p.addr.String()]
+	if c != nil {
+		c.lastHeard = now
+	}
+
+	body := p.data[1:]
+	switch packetKind(p.data[0]) {
+	case packetHello:
+		if c != nil {
+			// The welcome went astray; send it again
+			s.sendAll(c.addr, c.welcome)
+			return
+		}
+		hello, err := decodeHello(body)
+		if err != nil {
+			s.reject(p.addr, err.Error())
+			return
+		}
+		if err := s.join(p.addr, hello, now); err != nil {
+			s.reject(p.addr, err.Error())
+		}
+	case packetInput:
+		if c == nil {
+			return
+		}
+		snapshot, first, inputs, err := decodeInputs(body)
+		if err != nil {
+			return
+		}
+		c.snapshot = max(c.snapshot, snapshot)
+		// Packets repeat inputs; queue only the ones not seen yet
+		for i, in := range inputs {
+			if seq := first + uint64(i); seq > c.received {
+				c.queue = append(c.queue, queuedInput{seq, in})
+				c.received = seq
+			}
+		}
+	case packetBye:
+		if c != nil {
+			s.leave(c, "left")
+		}
+	}
+}
+
+// join hands a client a tank on the team they asked for.
+func (s *Server) join(addr net.Addr, hello Hello, now time.Time) error {
+	team := hello.Team
+	if team == AnyTeam {
+		team = sim.PlayerTeam
+		if s.players(sim.EnemyTeam) < s.players(sim.PlayerTeam) {
+			team = sim.EnemyTeam
+		}
+	}
+
+	id := s.freeTank(team)
+	if id < 0 && hello.Team == AnyTeam {
+		team = team.Opponent()
+		id = s.freeTank(team)
+	}
+	if id < 0 {
+		return fmt.Errorf("no free tank on the %s team", team)
+	}
+
+	// Tanks can only change class before the battle starts
+	t := s.tanks[id]
+	if hello.Class != "" && hello.Class != t.Class && s.game.Match.Phase == sim.MatchCountdown {
+		class, err := sim.FindTankClass(s.classes, hello.Class)
+		if err != nil {
+			return err
+		}
+		s.game.Refit(t, class)
+	}
+
+	w, err := welcomePackets(welcome{Tank: id, Config: s.config, Classes: s.classes})
+	if err != nil {
+		return err
+	}
+	c := &client{
+		addr:      addr,
+		tank:      id,
+		ai:        t.Controller,
+		control:   &remoteInput{},
+		welcome:   w,
+		lastHeard: now,
+	}
+	t.Controller = c.control
+	s.clients[addr.String()] = c
+
+	s.publish()
+
+	s.logf("%s joined the %s team in tank %d (%s)", addr, team, id, t.Class)
+	s.sendAll(addr, c.welcome)
+	return nil
+}
+
+// leave hands a client's tank back to the AI.
+func (s *Server) leave(c *client, why string) {
+	s.tanks[c.tank].Controller = c.ai
+	s.tanks[c.tank].Latency = 0
+	delete(s.clients, c.addr.String())
+	s.publish()
+	s.logf("%s %s; tank %d back under AI control", c.addr, why, c.tank)
+}
+
+// dropSilent lets go of clients that haven't been heard from in a while.
+func (s *Server) dropSilent(now time.Time) {
+	for _, c := range s.clients {
+		if now.Sub(c.lastHeard) > ClientTimeout {
+			s.leave(c, "timed out")
+		}
+	}
+}
+
+// players returns the number of clients on a team.
+func (s *Server) players(team sim.Team) int {
+	count := 0
+	for _, c := range s.clients {
+		if s.tanks[c.tank].Team == team {
+			count++
+		}
+	}
+	return count
+}
+
+// freeTank returns the first living tank on a team that no client drives,
+// or -1.
+func (s *Server) freeTank(team sim.Team) int {
+	for i, t := range s.tanks {
+		if t.Team != team || t.Health <= 0 {
+			continue
+		}
+		if _, remote := t.Controller.(*remoteInput); !remote {
+			return i
+		}
+	}
+	return -1
+}
+
+// step advances the match one tick and sends a snapshot every
+// SnapshotInterval ticks.
+func (s *Server) step() {
+	for _, c := range s.clients {
+		c.nextInput(s.tanks[c.tank], s.game.Clock.Tick+1)
+	}
+	s.game.Step(sim.Input{})
+	s.ticks++
+	if s.game.Match.Phase != s.status.Phase {
+		s.publish() // Only Run writes status, so it can read it unlocked
+	}
+
+	for _, e := range s.game.DrainEvents() {
+		if e.Kind == sim.EventObstacleDestroyed {
+			s.destroyed = append(s.destroyed, Destruction{At: e.Position, Direction: e.Direction})
+			continue
+		}
+		s.events = append(s.events, eventState(e, s.ids))
+	}
+
+	if s.ticks%SnapshotInterval == 0 {
+		s.sendSnapshot()
+		s.events = nil
+	}
+}
+
+// sendSnapshot sends each client the match as it changed since the latest
+// snapshot they have, and which of their inputs it reflects.
+func (s *Server) sendSnapshot() {
+	snapshot := s.snapshot()
+	bodies := make(map[*Snapshot][]byte) // By baseline; clients often share one
+	for _, c := range s.clients {
+		baseline := s.baseline(c.snapshot)
+		body, ok := bodies[baseline]
+		if !ok {
+			body = appendSnapshotBody(nil, snapshot, baseline)
+			bodies[baseline] = body
+		}
+		s.conn.WriteTo(appendSnapshot(nil, c.ack, body), c.addr)
+	}
+
+	s.sent = append(s.sent, snapshot)
+	if len(s.sent) > baselineSnapshots {
+		s.sent = s.sent[1:]
+	}
+}
+
+// baseline returns the snapshot sent at tick, or nil if it is too old.
+func (s *Server) baseline(tick int) *Snapshot {
+	for i := len(s.sent) - 1; i >= 0; i-- {
+		if s.sent[i].Tick == tick {
+			return s.sent[i]
+		}
+	}
+	return nil
+}
+
+func (s *Server) snapshot() *Snapshot {
+	game := s.game
+	snapshot := &Snapshot{
+		Tick:      game.Clock.Tick,
+		Match:     game.Match,
+		Tanks:     make([]TankState, len(s.tanks)),
+		Bullets:   make([]BulletState, len(game.Bullets)),
+		Zones:     make([]float32, len(game.Zones)),
+		Destroyed: s.destroyed,
+		Events:    s.events,
+	}
+	for i, t := range s.tanks {
+		snapshot.Tanks[i] = tankState(t)
+	}
+	for i, b := range game.Bullets {
+		snapshot.Bullets[i] = BulletState{Position: b.Position, Velocity: b.Velocity, Team: b.Team}
+	}
+	for i, zone := range game.Zones {
+		snapshot.Zones[i] = zone.Progress
+	}
+	return snapshot
+}
+
+func (s *Server) broadcast(data []byte) {
+	for _, c := range s.clients {
+		s.conn.WriteTo(data, c.addr)
+	}
+}
+
+func (s *Server) sendAll(addr net.Addr, packets [][]byte) {
+	for _, p := range packets {
+		s.conn.WriteTo(p, addr)
+	}
+}
+
+func (s *Server) reject(addr net.Addr, reason string) {
+	s.logf("turned away %s: %s", addr, reason)
+	s.conn.WriteTo(append([]byte{byte(packetReject)}, reason...), addr)
+}
@@ -0,0 +1,162 @@
+package netplay
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"tanks3d/sim"
+)
+
+// startServer runs a short match on localhost for the test's clients.
+func startServer(t *testing.T, cfg sim.Config, network Conditions) (*Server, <-chan error) {
+	t.Helper()
+	server, err := Listen("127.0.0.1:0", cfg, nil, network)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- server.Run() }()
+	t.Cleanup(func() { server.Close() })
+	return server, done
+}
+
+func dial(t *testing.T, server *Server, team sim.Team, network Conditions) *Client {
+	t.Helper()
+	client, err := Dial(server.Addr().String(), Hello{Team: team}, network, 3*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+// play runs clients in real time, each on its own input, until every one
+// has heard the match is over.
+func play(t *testing.T, clients []*Client, input func(client, frame int) sim.Input) {
+	t.Helper()
+	over := make([]bool, len(clients))
+	last := time.Now()
+	for frame := 0; ; frame++ {
+		time.Sleep(time.Second / sim.TickRate)
+		now := time.Now()
+		elapsed := float32(now.Sub(last).Seconds())
+		last = now
+
+		done := true
+		for i, c := range clients {
+			if over[i] {
+				continue
+			}
+			_, err := c.Update(elapsed, input(i, frame))
+			switch {
+			case errors.Is(err, ErrMatchOver):
+				over[i] = true
+			case err != nil:
+				t.Fatalf("client %d: %v", i, err)
+			default:
+				done = false
+			}
+		}
+		if done {
+			return
+		}
+	}
+}
+
+func TestServerTwoClients(t *testing.T) {
+	cfg := sim.Config{Seed: 3, Mode: "skirmish", Countdown: 250 * time.Millisecond, TimeLimit: 2 * time.Second}
+	server, done := startServer(t, cfg, Conditions{})
+	player := dial(t, server, sim.PlayerTeam, Conditions{})
+	enemy := dial(t, server, sim.EnemyTeam, Conditions{})
+	clients := []*Client{player, enemy}
+
+	if player.Tank().Team != sim.PlayerTeam || enemy.Tank().Team != sim.EnemyTeam {
+		t.Fatalf("clients got tanks on the %v and %v teams", player.Tank().Team, enemy.Tank().Team)
+	}
+	if status := server.Status(); status.Players != [2]int{1, 1} {
+		t.Errorf("server reports %v players per team, want one each", status.Players)
+	}
+	startPosition, startRotation := player.Tank().Position, enemy.Tank().Rotation
+
+	// The player drives ahead; the enemy turns on the spot
+	play(t, clients, func(client, frame int) sim.Input {
+		if client == 0 {
+			return sim.Input{Forward: true}
+		}
+		return sim.Input{TurnLeft: true}
+	})
+	if err := <-done; err != nil {
+		t.Fatalf("server: %v", err)
+	}
+
+	// Both clients end on the same final snapshot, which is the server's
+	a, b := player.history[len(player.history)-1], enemy.history[len(enemy.history)-1]
+	if a.Tick != b.Tick || !reflect.DeepEqual(a.Tanks, b.Tanks) || a.Match != b.Match {
+		t.Fatalf("clients disagree on the final state: tick %d vs %d", a.Tick, b.Tick)
+	}
+	if a.Tick != server.game.Clock.Tick || a.Match != server.game.Match {
+		t.Errorf("final snapshot at tick %d (%v), server ended at tick %d (%v)", a.Tick, a.Match.Phase, server.game.Clock.Tick, server.game.Match.Phase)
+	}
+	for i, tank := range server.tanks {
+		if d := distance(a.Tanks[i].Position, tank.Position); d > positionStep {
+			t.Errorf("tank %d is %v from where the server has it", i, d)
+		}
+		if a.Tanks[i].Health != tank.Health {
+			t.Errorf("tank %d health %d, server has %d", i, a.Tanks[i].Health, tank.Health)
+		}
+	}
+
+	// Each client's input drove its own tank on the server
+	if moved := distance(server.tanks[player.tank].Position, startPosition); moved < 1 {
+		t.Errorf("player's tank moved %v driving forward", moved)
+	}
+	if server.tanks[enemy.tank].Rotation == startRotation {
+		t.Error("enemy's tank didn't turn")
+	}
+}
+
+func TestPredictionConverges(t *testing.T) {
+	network := Conditions{Latency: 50 * time.Millisecond, Jitter: 20 * time.Millisecond, Loss: 0.1}
+	cfg := sim.Config{Seed: 3, Mode: "skirmish", Countdown: 250 * time.Millisecond, TimeLimit: 3 * time.Second}
+	server, done := startServer(t, cfg, network)
+	player := dial(t, server, sim.PlayerTeam, network)
+	start := player.Tank().Position
+
+	// Drive and turn for a couple of seconds, then stop and let the
+	// server's word on the tank catch up
+	driving := sim.Ticks(cfg.Countdown + 2*time.Second)
+	var worst, settled float32
+	play(t, []*Client{player}, func(_, frame int) sim.Input {
+		correction := player.Stats().Correction
+		if frame < driving {
+			worst = max(worst, correction)
+			return sim.Input{Forward: true, TurnLeft: frame%120 < 60}
+		}
+		settled = correction
+		return sim.Input{}
+	})
+	if err := <-done; err != nil {
+		t.Fatalf("server: %v", err)
+	}
+	t.Logf("largest correction while driving %v, latest once stopped %v", worst, settled)
+
+	want := server.tanks[player.tank]
+	if moved := distance(want.Position, start); moved < 5 {
+		t.Fatalf("tank moved only %v", moved)
+	}
+	// Inputs that reach the server late or bunched up move the tank a
+	// tick or two off its predicted track, but replaying the unacknowledged
+	// ones over each snapshot keeps it from drifting further despite the
+	// lag and lost packets
+	if worst > 2 {
+		t.Errorf("prediction was corrected by up to %v while driving", worst)
+	}
+	if settled > 2*positionStep {
+		t.Errorf("prediction still corrected by %v after stopping", settled)
+	}
+	if d := distance(player.Tank().Position, want.Position); d > 2*positionStep {
+		t.Errorf("predicted tank ended %v from the server's", d)
+	}
+}
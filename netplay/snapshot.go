@@ -0,0 +1,526 @@
+package netplay
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+
+	"tanks3d/sim"
+)
+
+// Snapshot is the state of the match at one tick, as much as a client
+// needs to draw it.
+type Snapshot struct {
+	Tick    int
+	Match   sim.Match
+	Tanks   []TankState // In Game.Tanks order
+	Bullets []BulletState
+	Zones   []float32 // Capture progress of each base
+
+	// Destroyed lists every obstacle brought down so far, in order
+	Destroyed []Destruction
+
+	// Events raised since the previous snapshot, apart from destruction
+	Events []EventState
+}
+
+type TankState struct {
+	Class          string
+	Position       sim.Vec3
+	Rotation       float32
+	Pitch          float32
+	Roll           float32
+	TurretRotation float32
+	GunElevation   float32
+	Health         int
+	Spotted        bool
+	LastShot       int
+	Aim            float32 // Aiming circle radius
+	Aiming         bool
+}
+
+func tankState(t *sim.Tank) TankState {
+	return TankState{
+		Class:          t.Class,
+		Position:       t.Position,
+		Rotation:       t.Rotation,
+		Pitch:          t.Pitch,
+		Roll:           t.Roll,
+		TurretRotation: t.TurretRotation,
+		GunElevation:   t.GunElevation,
+		Health:         t.Health,
+		Spotted:        t.Spotted,
+		LastShot:       t.LastShot,
+		Aim:            t.AimingCircle.CurrentRadius,
+		Aiming:         t.AimingCircle.IsAiming,
+	}
+}
+
+func (s TankState) apply(t *sim.Tank) {
+	t.Position = s.Position
+	t.Rotation = s.Rotation
+	t.Pitch = s.Pitch
+	t.Roll = s.Roll
+	t.TurretRotation = s.TurretRotation
+	t.GunElevation = s.GunElevation
+	t.Health = s.Health
+	t.Spotted = s.Spotted
+	t.LastShot = s.LastShot
+	t.AimingCircle.CurrentRadius = s.Aim
+	t.AimingCircle.IsAiming = s.Aiming
+}
+
+type BulletState struct {
+	Position sim.Vec3
+	Velocity sim.Vec3
+	Team     sim.Team
+}
+
+// Destruction is an obstacle brought down, identified by where it stood.
+type Destruction struct {
+	At        sim.Vec3
+	Direction sim.Vec3
+}
+
+// EventState is a sim.Event with its tanks named by index.
+type EventState struct {
+	Kind     sim.EventKind
+	Position sim.Vec3
+	Tank     int // -1 for none
+	Shooter  int
+	Outcome  sim.HitOutcome
+	Damage   int
+}
+
+func eventState(e sim.Event, ids map[*sim.Tank]int) EventState {
+	id := func(t *sim.Tank) int {
+		if id, ok := ids[t]; ok {
+			return id
+		}
+		return -1
+	}
+	return EventState{
+		Kind:     e.Kind,
+		Position: e.Position,
+		Tank:     id(e.Tank),
+		Shooter:  id(e.Shooter),
+		Outcome:  e.Outcome,
+		Damage:   e.Damage,
+	}
+}
+
+func (s EventState) event(tick int, tanks []*sim.Tank) sim.Event {
+	tank := func(id int) *sim.Tank {
+		if id >= 0 && id < len(tanks) {
+			return tanks[id]
+		}
+		return nil
+	}
+	return sim.Event{
+		Kind:     s.Kind,
+		Tick:     tick,
+		Position: s.Position,
+		Tank:     tank(s.Tank),
+		Shooter:  tank(s.Shooter),
+		Outcome:  s.Outcome,
+		Damage:   s.Damage,
+	}
+}
+
+// SnapshotFormat is the version of the snapshot encoding. It leads every
+// snapshot, so a client never misreads one from a server that encodes
+// them differently.
+const SnapshotFormat = 1
+
+// Snapshots are sent as the change from one the client already has, the
+// baseline, with floats rounded to fixed steps:
+//
+//	format   byte
+//	tick     uvarint
+//	baseline uvarint, the baseline's tick or 0 for none
+//	match    phase, end, winner, start and end tick
+//	tanks    count, then per tank a bitmask of the fields that changed
+//	         followed by each one's change
+//	bullets  count, then each in full; they live too briefly to track
+//	zones    count, then each one's change
+//	destroyed count so far, then those the baseline didn't have
+//	events   count, then each in full
+//
+// Ticks start at 1, so no snapshot is at tick 0.
+const (
+	positionStep = 1.0 / 256           // Metres
+	velocityStep = 1.0 / 1024          // Metres per tick
+	angleStep    = 2 * math.Pi / 65536 // Radians; angles wrap at 16 bits
+	progressStep = 1.0 / 4096
+)
+
+// Tank fields in the order their changes are sent, numbered by bit of
+// the changed mask. They are compared and sent as whole steps.
+const (
+	fieldX = iota
+	fieldY
+	fieldZ
+	fieldRotation
+	fieldPitch
+	fieldRoll
+	fieldTurretRotation
+	fieldGunElevation
+	fieldHealth
+	fieldSpotted
+	fieldLastShot
+	fieldAim
+	fieldAiming
+	fieldClass
+	tankFields = fieldClass // Fields held as steps; the class is sent as a string
+)
+
+type quantizedTank [tankFields]int64
+
+func isAngle(field int) bool {
+	return field >= fieldRotation && field <= fieldGunElevation
+}
+
+func quantize(v, step float32) int64 {
+	return int64(math.Round(float64(v) / float64(step)))
+}
+
+// quantizeAngle wraps an angle to half a turn either way, so the same
+// heading always gives the same steps.
+func quantizeAngle(a float32) int64 {
+	return int64(int16(quantize(float32(math.Remainder(float64(a), 2*math.Pi)), angleStep)))
+}
+
+func boolStep(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func quantizeTank(s TankState) quantizedTank {
+	return quantizedTank{
+		fieldX:              quantize(s.Position.X, positionStep),
+		fieldY:              quantize(s.Position.Y, positionStep),
+		fieldZ:              quantize(s.Position.Z, positionStep),
+		fieldRotation:       quantizeAngle(s.Rotation),
+		fieldPitch:          quantizeAngle(s.Pitch),
+		fieldRoll:           quantizeAngle(s.Roll),
+		fieldTurretRotation: quantizeAngle(s.TurretRotation),
+		fieldGunElevation:   quantizeAngle(s.GunElevation),
+		fieldHealth:         int64(s.Health),
+		fieldSpotted:        boolStep(s.Spotted),
+		fieldLastShot:       int64(s.LastShot),
+		fieldAim:            quantize(s.Aim, positionStep),
+		fieldAiming:         boolStep(s.Aiming),
+	}
+}
+
+func (q quantizedTank) state(class string) TankState {
+	return TankState{
+		Class:          class,
+		Position:       sim.NewVec3(float32(q[fieldX])*positionStep, float32(q[fieldY])*positionStep, float32(q[fieldZ])*positionStep),
+		Rotation:       float32(q[fieldRotation]) * angleStep,
+		Pitch:          float32(q[fieldPitch]) * angleStep,
+		Roll:           float32(q[fieldRoll]) * angleStep,
+		TurretRotation: float32(q[fieldTurretRotation]) * angleStep,
+		GunElevation:   float32(q[fieldGunElevation]) * angleStep,
+		Health:         int(q[fieldHealth]),
+		Spotted:        q[fieldSpotted] != 0,
+		LastShot:       int(q[fieldLastShot]),
+		Aim:            float32(q[fieldAim]) * positionStep,
+		Aiming:         q[fieldAiming] != 0,
+	}
+}
+
+// appendSnapshot encodes a snapshot for one client, with ack the last of
+// their inputs the server has applied.
+func appendSnapshot(b []byte, ack uint64, body []byte) []byte {
+	b = append(b, byte(packetSnapshot))
+	b = binary.AppendUvarint(b, ack)
+	return append(b, body...)
+}
+
+// appendSnapshotBody encodes s as the change from baseline, which is nil
+// for a client that has nothing to build on yet.
+func appendSnapshotBody(b []byte, s, baseline *Snapshot) []byte {
+	if baseline == nil {
+		baseline = &Snapshot{}
+	}
+	b = append(b, SnapshotFormat)
+	b = binary.AppendUvarint(b, uint64(s.Tick))
+	b = binary.AppendUvarint(b, uint64(baseline.Tick))
+
+	b = append(b, byte(s.Match.Phase), byte(s.Match.End))
+	b = binary.AppendVarint(b, int64(s.Match.Winner))
+	b = binary.AppendUvarint(b, uint64(s.Match.StartTick))
+	b = binary.AppendUvarint(b, uint64(s.Match.EndTick))
+
+	b = binary.AppendUvarint(b, uint64(len(s.Tanks)))
+	for i, t := range s.Tanks {
+		var base TankState
+		if i < len(baseline.Tanks) {
+			base = baseline.Tanks[i]
+		}
+		b = appendTank(b, t, base)
+	}
+
+	b = binary.AppendUvarint(b, uint64(len(s.Bullets)))
+	for _, bullet := range s.Bullets {
+		b = appendVec(b, bullet.Position, positionStep)
+		b = appendVec(b, bullet.Velocity, velocityStep)
+		b = binary.AppendVarint(b, int64(bullet.Team))
+	}
+
+	b = binary.AppendUvarint(b, uint64(len(s.Zones)))
+	for i, progress := range s.Zones {
+		var base float32
+		if i < len(baseline.Zones) {
+			base = baseline.Zones[i]
+		}
+		b = binary.AppendVarint(b, quantize(progress, progressStep)-quantize(base, progressStep))
+	}
+
+	// Obstacles are found by exactly where they stood, so that isn't rounded
+	b = binary.AppendUvarint(b, uint64(len(s.Destroyed)))
+	for _, d := range s.Destroyed[min(len(baseline.Destroyed), len(s.Destroyed)):] {
+		for _, v := range [3]float32{d.At.X, d.At.Y, d.At.Z} {
+			b = binary.LittleEndian.AppendUint32(b, math.Float32bits(v))
+		}
+		b = appendVec(b, d.Direction, positionStep)
+	}
+
+	b = binary.AppendUvarint(b, uint64(len(s.Events)))
+	for _, e := range s.Events {
+		b = append(b, byte(e.Kind), byte(e.Outcome))
+		b = appendVec(b, e.Position, positionStep)
+		b = binary.AppendVarint(b, int64(e.Tank))
+		b = binary.AppendVarint(b, int64(e.Shooter))
+		b = binary.AppendVarint(b, int64(e.Damage))
+	}
+	return b
+}
+
+func appendTank(b []byte, t, base TankState) []byte {
+	q, qBase := quantizeTank(t), quantizeTank(base)
+	var changed uint64
+	for field := range q {
+		if q[field] != qBase[field] {
+			changed |= 1 << field
+		}
+	}
+	if t.Class != base.Class {
+		changed |= 1 << fieldClass
+	}
+
+	b = binary.AppendUvarint(b, changed)
+	for field := range q {
+		if changed&(1<<field) == 0 {
+			continue
+		}
+		delta := q[field] - qBase[field]
+		if isAngle(field) {
+			delta = int64(int16(delta)) // The short way round
+		}
+		b = binary.AppendVarint(b, delta)
+	}
+	if changed&(1<<fieldClass) != 0 {
+		b = binary.AppendUvarint(b, uint64(len(t.Class)))
+		b = append(b, t.Class...)
+	}
+	return b
+}
+
+func appendVec(b []byte, v sim.Vec3, step float32) []byte {
+	b = binary.AppendVarint(b, quantize(v.X, step))
+	b = binary.AppendVarint(b, quantize(v.Y, step))
+	return binary.AppendVarint(b, quantize(v.Z, step))
+}
+
+// errNoBaseline is a snapshot built on one the client no longer has.
+var errNoBaseline = errors.New("snapshot baseline missing")
+
+// decodeSnapshot decodes a snapshot packet, looking up the snapshot it
+// was built on by tick.
+func decodeSnapshot(b []byte, baseline func(tick int) *Snapshot) (uint64, *Snapshot, error) {
+	ack, n := binary.Uvarint(b)
+	if n <= 0 {
+		return 0, nil, errors.New("bad snapshot ack")
+	}
+	s, err := decodeSnapshotBody(b[n:], baseline)
+	return ack, s, err
+}
+
+func decodeSnapshotBody(b []byte, baseline func(tick int) *Snapshot) (*Snapshot, error) {
+	r := snapshotReader{b: b}
+	if format := r.byte(); r.err == nil && format != SnapshotFormat {
+		return nil, fmt.Errorf("snapshot format %d, want %d", format, SnapshotFormat)
+	}
+	s := &Snapshot{Tick: int(r.uvarint())}
+	base := &Snapshot{}
+	if tick := int(r.uvarint()); r.err == nil && tick != 0 {
+		if base = baseline(tick); base == nil {
+			return nil, errNoBaseline
+		}
+	}
+
+	s.Match.Phase = sim.MatchPhase(r.byte())
+	s.Match.End = sim.MatchEnd(r.byte())
+	s.Match.Winner = sim.Team(r.varint())
+	s.Match.StartTick = int(r.uvarint())
+	s.Match.EndTick = int(r.uvarint())
+
+	s.Tanks = make([]TankState, r.count())
+	for i := range s.Tanks {
+		var t TankState
+		if i < len(base.Tanks) {
+			t = base.Tanks[i]
+		}
+		s.Tanks[i] = r.tank(t)
+	}
+
+	s.Bullets = make([]BulletState, r.count())
+	for i := range s.Bullets {
+		s.Bullets[i] = BulletState{
+			Position: r.vec(positionStep),
+			Velocity: r.vec(velocityStep),
+			Team:     sim.Team(r.varint()),
+		}
+	}
+
+	s.Zones = make([]float32, r.count())
+	for i := range s.Zones {
+		var progress int64
+		if i < len(base.Zones) {
+			progress = quantize(base.Zones[i], progressStep)
+		}
+		s.Zones[i] = float32(progress+r.varint()) * progressStep
+	}
+
+	// Only the destructions the baseline lacks take up room
+	destroyed := r.uvarint()
+	kept := min(uint64(len(base.Destroyed)), destroyed)
+	if destroyed-kept > uint64(len(r.b)) {
+		r.fail()
+		destroyed, kept = 0, 0
+	}
+	s.Destroyed = append(make([]Destruction, 0, destroyed), base.Destroyed[:kept]...)
+	for i := kept; i < destroyed && r.err == nil; i++ {
+		var at [3]float32
+		for j := range at {
+			at[j] = math.Float32frombits(r.uint32())
+		}
+		s.Destroyed = append(s.Destroyed, Destruction{
+			At:        sim.NewVec3(at[0], at[1], at[2]),
+			Direction: r.vec(positionStep),
+		})
+	}
+
+	s.Events = make([]EventState, r.count())
+	for i := range s.Events {
+		s.Events[i] = EventState{
+			Kind:     sim.EventKind(r.byte()),
+			Outcome:  sim.HitOutcome(r.byte()),
+			Position: r.vec(positionStep),
+			Tank:     int(r.varint()),
+			Shooter:  int(r.varint()),
+			Damage:   int(r.varint()),
+		}
+	}
+
+	if r.err != nil {
+		return nil, r.err
+	}
+	return s, nil
+}
+
+// snapshotReader reads the parts of a snapshot in turn. After the first
+// error every read returns zero, so the error is checked once at the end.
+type snapshotReader struct {
+	b   []byte
+	err error
+}
+
+func (r *snapshotReader) fail() {
+	if r.err == nil {
+		r.err = errors.New("truncated snapshot")
+	}
+	r.b = nil
+}
+
+func (r *snapshotReader) byte() byte {
+	if len(r.b) < 1 {
+		r.fail()
+		return 0
+	}
+	v := r.b[0]
+	r.b = r.b[1:]
+	return v
+}
+
+func (r *snapshotReader) uint32() uint32 {
+	if len(r.b) < 4 {
+		r.fail()
+		return 0
+	}
+	v := binary.LittleEndian.Uint32(r.b)
+	r.b = r.b[4:]
+	return v
+}
+
+func (r *snapshotReader) uvarint() uint64 {
+	v, n := binary.Uvarint(r.b)
+	if n <= 0 {
+		r.fail()
+		return 0
+	}
+	r.b = r.b[n:]
+	return v
+}
+
+func (r *snapshotReader) varint() int64 {
+	v, n := binary.Varint(r.b)
+	if n <= 0 {
+		r.fail()
+		return 0
+	}
+	r.b = r.b[n:]
+	return v
+}
+
+// count reads the length of a list, which can't be longer than the bytes
+// left to hold it.
+func (r *snapshotReader) count() int {
+	n := r.uvarint()
+	if n > uint64(len(r.b)) {
+		r.fail()
+		return 0
+	}
+	return int(n)
+}
+
+func (r *snapshotReader) vec(step float32) sim.Vec3 {
+	x, y, z := r.varint(), r.varint(), r.varint()
+	return sim.NewVec3(float32(x)*step, float32(y)*step, float32(z)*step)
+}
+
+func (r *snapshotReader) tank(base TankState) TankState {
+	q := quantizeTank(base)
+	changed := r.uvarint()
+	for field := range q {
+		if changed&(1<<field) == 0 {
+			continue
+		}
+		q[field] += r.varint()
+		if isAngle(field) {
+			q[field] = int64(int16(q[field]))
+		}
+	}
+	class := base.Class
+	if changed&(1<<fieldClass) != 0 {
+		n := r.count()
+		class = string(r.b[:n])
+		r.b = r.b[n:]
+	}
+	return q.state(class)
+}
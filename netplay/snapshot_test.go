@@ -0,0 +1,252 @@
+package netplay
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"testing"
+
+	"tanks3d/sim"
+)
+
+// snapshotBudget is the most a snapshot of a full 15v15 battle may take.
+// Snapshots go out every SnapshotInterval ticks, so this is well under
+// it per tick.
+const snapshotBudget = 3 * 1024
+
+// battleSnapshots plays a 15v15 match under AI control and returns a
+// snapshot every SnapshotInterval ticks, with the shells padded out to a
+// few dozen.
+func battleSnapshots(t *testing.T, ticks int) []*Snapshot {
+	t.Helper()
+	s := NewServer(nil, sim.Config{Seed: 7, Mode: "15v15", RamDamage: sim.DefaultRamDamage}, nil)
+	var snapshots []*Snapshot
+	for i := 1; i <= ticks; i++ {
+		s.game.Step(sim.Input{})
+		for _, e := range s.game.DrainEvents() {
+			if e.Kind == sim.EventObstacleDestroyed {
+				s.destroyed = append(s.destroyed, Destruction{At: e.Position, Direction: e.Direction})
+				continue
+			}
+			s.events = append(s.events, eventState(e, s.ids))
+		}
+		if i%SnapshotInterval != 0 {
+			continue
+		}
+		snapshot := s.snapshot()
+		s.events = nil
+		for j := len(snapshot.Bullets); j < 40; j++ {
+			snapshot.Bullets = append(snapshot.Bullets, BulletState{
+				Position: sim.NewVec3(float32(j)-20.3, 4.1, float32(i)/10),
+				Velocity: sim.NewVec3(3.2, -0.1*float32(j%5), -4.4),
+				Team:     sim.Team(j % 2),
+			})
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+	if len(snapshots[0].Tanks) != 30 {
+		t.Fatalf("%d tanks, want 30", len(snapshots[0].Tanks))
+	}
+	return snapshots
+}
+
+// history stands in for the client's received snapshots.
+type history []*Snapshot
+
+func (h history) baseline(tick int) *Snapshot {
+	for _, s := range h {
+		if s.Tick == tick {
+			return s
+		}
+	}
+	return nil
+}
+
+func angleDistance(a, b float32) float64 {
+	return math.Abs(math.Remainder(float64(a-b), 2*math.Pi))
+}
+
+// checkSnapshot compares a decoded snapshot with the one encoded, allowing
+// for the rounding.
+func checkSnapshot(t *testing.T, got, want *Snapshot) {
+	t.Helper()
+	posTolerance := math.Sqrt(3) * positionStep / 2
+	if got.Tick != want.Tick || got.Match != want.Match {
+		t.Fatalf("tick %d %+v, want tick %d %+v", got.Tick, got.Match, want.Tick, want.Match)
+	}
+	if len(got.Tanks) != len(want.Tanks) || len(got.Bullets) != len(want.Bullets) || len(got.Zones) != len(want.Zones) ||
+		len(got.Destroyed) != len(want.Destroyed) || len(got.Events) != len(want.Events) {
+		t.Fatalf("decoded %d tanks, %d bullets, %d zones, %d destroyed, %d events; want %d, %d, %d, %d, %d",
+			len(got.Tanks), len(got.Bullets), len(got.Zones), len(got.Destroyed), len(got.Events),
+			len(want.Tanks), len(want.Bullets), len(want.Zones), len(want.Destroyed), len(want.Events))
+	}
+	for i, w := range want.Tanks {
+		g := got.Tanks[i]
+		if g.Class != w.Class || g.Health != w.Health || g.Spotted != w.Spotted || g.LastShot != w.LastShot || g.Aiming != w.Aiming {
+			t.Errorf("tank %d: %+v, want %+v", i, g, w)
+		}
+		if d := float64(distance(g.Position, w.Position)); d > posTolerance {
+			t.Errorf("tank %d position off by %v", i, d)
+		}
+		for _, pair := range [][2]float32{
+			{g.Rotation, w.Rotation}, {g.Pitch, w.Pitch}, {g.Roll, w.Roll},
+			{g.TurretRotation, w.TurretRotation}, {g.GunElevation, w.GunElevation},
+		} {
+			if d := angleDistance(pair[0], pair[1]); d > angleStep/2+1e-6 {
+				t.Errorf("tank %d angle off by %v", i, d)
+			}
+		}
+		if d := math.Abs(float64(g.Aim - w.Aim)); d > positionStep/2 {
+			t.Errorf("tank %d aim off by %v", i, d)
+		}
+	}
+	for i, w := range want.Bullets {
+		g := got.Bullets[i]
+		if g.Team != w.Team || float64(distance(g.Position, w.Position)) > posTolerance || float64(distance(g.Velocity, w.Velocity)) > math.Sqrt(3)*velocityStep/2 {
+			t.Errorf("bullet %d: %+v, want %+v", i, g, w)
+		}
+	}
+	for i, w := range want.Zones {
+		if d := math.Abs(float64(got.Zones[i] - w)); d > progressStep/2 {
+			t.Errorf("zone %d progress off by %v", i, d)
+		}
+	}
+	for i, w := range want.Destroyed {
+		if got.Destroyed[i].At != w.At {
+			t.Errorf("destruction %d at %v, want exactly %v", i, got.Destroyed[i].At, w.At)
+		}
+	}
+	for i, w := range want.Events {
+		g := got.Events[i]
+		if g.Kind != w.Kind || g.Tank != w.Tank || g.Shooter != w.Shooter || g.Outcome != w.Outcome || g.Damage != w.Damage {
+			t.Errorf("event %d: %+v, want %+v", i, g, w)
+		}
+	}
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	var received history
+	var last *Snapshot
+	for i, s := range battleSnapshots(t, 40*sim.TickRate) {
+		full, err := decodeSnapshotBody(appendSnapshotBody(nil, s, nil), received.baseline)
+		if err != nil {
+			t.Fatalf("snapshot %d in full: %v", i, err)
+		}
+		checkSnapshot(t, full, s)
+
+		// Build on a snapshot acked a few back, as the server does
+		var baseline *Snapshot
+		if len(received) >= 3 {
+			baseline = received[len(received)-3]
+		}
+		delta, err := decodeSnapshotBody(appendSnapshotBody(nil, s, baseline), received.baseline)
+		if err != nil {
+			t.Fatalf("snapshot %d as a delta: %v", i, err)
+		}
+		checkSnapshot(t, delta, s)
+
+		// The client builds on what it decoded, not on what the server has
+		received = append(received, delta)
+		if len(received) > snapshotHistory {
+			received = received[1:]
+		}
+		last = s
+	}
+	if len(last.Destroyed) == 0 {
+		t.Error("no obstacles destroyed, so destruction deltas went untested")
+	}
+}
+
+func TestSnapshotAngleWrap(t *testing.T) {
+	angles := []float32{math.Pi, -math.Pi, math.Pi - 1e-4, -math.Pi + 1e-4, 3 * math.Pi, -7, 0}
+	for _, from := range angles {
+		for _, to := range angles {
+			baseline := &Snapshot{Tick: 1, Tanks: []TankState{{Rotation: from, TurretRotation: from}}}
+			s := &Snapshot{Tick: 3, Tanks: []TankState{{Rotation: to, TurretRotation: -to}}}
+			got, err := decodeSnapshotBody(appendSnapshotBody(nil, s, baseline), history{baseline}.baseline)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tank := got.Tanks[0]
+			if d := angleDistance(tank.Rotation, to); d > angleStep {
+				t.Errorf("rotation %v after %v decoded %v apart", to, from, d)
+			}
+			if d := angleDistance(tank.TurretRotation, -to); d > angleStep {
+				t.Errorf("turret rotation %v after %v decoded %v apart", -to, from, d)
+			}
+			if tank.Rotation < -math.Pi-1e-6 || tank.Rotation > math.Pi+1e-6 {
+				t.Errorf("rotation %v decoded outside half a turn: %v", to, tank.Rotation)
+			}
+		}
+	}
+}
+
+func TestSnapshotQuantization(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 1000; i++ {
+		want := sim.NewVec3((rng.Float32()-0.5)*400, rng.Float32()*40, (rng.Float32()-0.5)*400)
+		s := &Snapshot{Tick: 1, Tanks: []TankState{{Position: want}}}
+		got, err := decodeSnapshotBody(appendSnapshotBody(nil, s, nil), history(nil).baseline)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p := got.Tanks[0].Position
+		for _, d := range []float32{p.X - want.X, p.Y - want.Y, p.Z - want.Z} {
+			if math.Abs(float64(d)) > positionStep/2 {
+				t.Fatalf("%v decoded as %v, more than half a step off", want, p)
+			}
+		}
+	}
+}
+
+func TestSnapshotCorrupt(t *testing.T) {
+	snapshots := battleSnapshots(t, 10*sim.TickRate)
+	s, baseline := snapshots[len(snapshots)-1], snapshots[len(snapshots)-4]
+	received := history{baseline}
+	data := appendSnapshotBody(nil, s, baseline)
+
+	for n := 0; n < len(data); n++ {
+		if _, err := decodeSnapshotBody(data[:n], received.baseline); err == nil {
+			t.Errorf("snapshot cut to %d of %d bytes decoded without error", n, len(data))
+		}
+	}
+
+	// Garbage must never panic, whatever it decodes to
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 2000; i++ {
+		corrupt := append([]byte(nil), data...)
+		for j := 0; j < 1+rng.Intn(8); j++ {
+			corrupt[rng.Intn(len(corrupt))] = byte(rng.Intn(256))
+		}
+		decodeSnapshotBody(corrupt, received.baseline)
+	}
+
+	wrongFormat := append([]byte{SnapshotFormat + 1}, data[1:]...)
+	if _, err := decodeSnapshotBody(wrongFormat, received.baseline); err == nil {
+		t.Error("snapshot in an unknown format decoded without error")
+	}
+	if _, err := decodeSnapshotBody(data, history(nil).baseline); !errors.Is(err, errNoBaseline) {
+		t.Errorf("snapshot without its baseline: %v, want %v", err, errNoBaseline)
+	}
+	if _, _, err := decodeSnapshot(nil, received.baseline); err == nil {
+		t.Error("empty packet decoded without error")
+	}
+}
+
+func TestSnapshotSize(t *testing.T) {
+	snapshots := battleSnapshots(t, 30*sim.TickRate)
+	largestFull, largestDelta := 0, 0
+	for i, s := range snapshots {
+		largestFull = max(largestFull, len(appendSnapshotBody(nil, s, nil)))
+		if i >= 3 {
+			largestDelta = max(largestDelta, len(appendSnapshotBody(nil, s, snapshots[i-3])))
+		}
+	}
+	t.Logf("30 tanks, 40 shells: %d bytes in full, %d as a delta", largestFull, largestDelta)
+	if largestFull > snapshotBudget || largestDelta > snapshotBudget {
+		t.Errorf("snapshots up to %d bytes, over the %d byte budget", max(largestFull, largestDelta), snapshotBudget)
+	}
+	if largestDelta >= largestFull {
+		t.Errorf("deltas (%d bytes) no smaller than full snapshots (%d bytes)", largestDelta, largestFull)
+	}
+}
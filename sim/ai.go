@@ -0,0 +1,409 @@
+package sim
+
+import "math"
+
+// Controller decides what a tank does each tick. Implementations return the
+// same Input a human player would produce, so any tank can be driven by any
+// controller.
+type Controller interface {
+	Control(g *Game, t *Tank) Input
+}
+
+// AIState is the behaviour a StateAI is currently carrying out.
+type AIState int
+
+const (
+	AIPatrol  AIState = iota // Drive between waypoints
+	AISearch                 // Head for where a target was last seen
+	AIEngage                 // Fight a visible target at preferred range
+	AIFlank                  // Circle to a target's side before engaging
+	AIRetreat                // Fall back behind cover at low health
+)
+
+func (s AIState) String() string {
+	switch s {
+	case AIPatrol:
+		return "patrol"
+	case AISearch:
+		return "search"
+	case AIEngage:
+		return "engage"
+	case AIFlank:
+		return "flank"
+	case AIRetreat:
+		return "retreat"
+	}
+	return "unknown"
+}
+
+// AIProfile tunes how capable a StateAI is.
+type AIProfile struct {
+	Name           string
+	PreferredRange float32 // Distance the AI tries to fight at
+	FireThreshold  float32 // Aiming circle radius it waits for before firing
+	ReactionTicks  int     // Delay between acquiring a target and opening fire
+	DecisionTicks  int     // How often the AI reconsiders its state
+	FlankChance    float32 // Chance of flanking rather than engaging head-on
+	RetreatHealth  float32 // Health fraction below which it falls back to cover
+}
+
+// AIProfiles are the built-in difficulty levels.
+var AIProfiles = map[string]AIProfile{
+	"easy": {
+		Name:           "easy",
+		PreferredRange: 30,
+		FireThreshold:  60,
+		ReactionTicks:  120,
+		DecisionTicks:  60,
+		FlankChance:    0.1,
+		RetreatHealth:  0.15,
+	},
+	"normal": {
+		Name:           "normal",
+		PreferredRange: 35,
+		FireThreshold:  45,
+		ReactionTicks:  45,
+		DecisionTicks:  30,
+		FlankChance:    0.3,
+		RetreatHealth:  0.3,
+	},
+	"hard": {
+		Name:           "hard",
+		PreferredRange: 40,
+		FireThreshold:  28,
+		ReactionTicks:  20,
+		DecisionTicks:  15,
+		FlankChance:    0.5,
+		RetreatHealth:  0.35,
+	},
+}
+
+// aiProfile returns the named difficulty, defaulting to normal.
+func aiProfile(name string) AIProfile {
+	if profile, ok := AIProfiles[name]; ok {
+		return profile
+	}
+	return AIProfiles["normal"]
+}
+
+// aiReplanTicks is how often a StateAI replans its route even when its
+// destination has not moved, so it recovers after being shoved off course.
+const aiReplanTicks = 90
+
+// StateAI is a finite-state enemy controller: it patrols waypoints, searches
+// where it last saw a target, engages or flanks visible targets and retreats
+// to cover when badly damaged.
+type StateAI struct {
+	Profile   AIProfile
+	State     AIState
+	Waypoints []Vec3
+
+	waypoint     int
+	target       *Tank
+	seenAt       int // Tick the current target was acquired
+	lastKnown    Vec3
+	hasLastKnown bool
+	nextDecision int
+	flankSide    float32
+	cover        Vec3
+	path         []Vec3 // Remaining waypoints of the planned route
+	pathGoal     Vec3
+	replanAt     int
+	progressAt   int // Tick of the next check that the tank is getting anywhere
+	progressFrom Vec3
+	reverseUntil int
+	reverseTurn  float32
+}
+
+func NewStateAI(profile AIProfile, waypoints []Vec3) *StateAI {
+	return &StateAI{
+		Profile:   profile,
+		State:     AIPatrol,
+		Waypoints: waypoints,
+	}
+}
+
+func (ai *StateAI) Control(g *Game, t *Tank) Input {
+	now := g.Clock.Tick
+
+	ai.perceive(g, t)
+	if now >= ai.nextDecision {
+		ai.decide(g, t)
+		ai.nextDecision = now + ai.Profile.DecisionTicks
+	}
+
+	var in Input
+	switch ai.State {
+	case AIPatrol:
+		ai.patrol(g, t, &in)
+	case AISearch:
+		ai.search(g, t, &in)
+	case AIEngage:
+		ai.engage(g, t, &in)
+	case AIFlank:
+		ai.flank(g, t, &in)
+	case AIRetreat:
+		ai.retreat(g, t, &in)
+	}
+
+	if ai.target != nil {
+		ai.aim(g, t, &in)
+	}
+	return in
+}
+
+// perceive picks the nearest spotted opponent and remembers where it was.
+func (ai *StateAI) perceive(g *Game, t *Tank) {
+	target := g.nearestVisibleOpponent(t)
+	if target != nil {
+		if target != ai.target {
+			ai.seenAt = g.Clock.Tick
+		}
+		ai.lastKnown = target.Position
+		ai.hasLastKnown = true
+	}
+	ai.target = target
+}
+
+func (ai *StateAI) decide(g *Game, t *Tank) {
+	health := float32(t.Health) / float32(t.MaxHealth)
+
+	switch {
+	case health <= ai.Profile.RetreatHealth && ai.hasLastKnown:
+		if ai.State != AIRetreat {
+			ai.cover = g.coverFrom(t.Position, ai.lastKnown)
+		}
+		ai.State = AIRetreat
+	case ai.target != nil:
+		if ai.State == AIEngage || ai.State == AIFlank {
+			return
+		}
+		ai.State = AIEngage
+		if g.rng.Float32() < ai.Profile.FlankChance {
+			ai.State = AIFlank
+			ai.flankSide = 1
+			if g.rng.Float32() < 0.5 {
+				ai.flankSide = -1
+			}
+		}
+	case ai.hasLastKnown:
+		ai.State = AISearch
+	default:
+		ai.State = AIPatrol
+	}
+}
+
+func (ai *StateAI) patrol(g *Game, t *Tank, in *Input) {
+	if len(ai.Waypoints) == 0 {
+		return
+	}
+
+	waypoint := ai.Waypoints[ai.waypoint%len(ai.Waypoints)]
+	if distance2D(t.Position, waypoint) < 4 {
+		ai.waypoint = (ai.waypoint + 1) % len(ai.Waypoints)
+		return
+	}
+	ai.moveTo(g, t, waypoint, in)
+}
+
+func (ai *StateAI) search(g *Game, t *Tank, in *Input) {
+	if distance2D(t.Position, ai.lastKnown) < 6 {
+		// Nobody here any more; go back to patrolling
+		ai.hasLastKnown = false
+		ai.State = AIPatrol
+		return
+	}
+	ai.moveTo(g, t, ai.lastKnown, in)
+}
+
+func (ai *StateAI) engage(g *Game, t *Tank, in *Input) {
+	if ai.target == nil {
+		ai.search(g, t, in)
+		return
+	}
+
+	distance := distance2D(t.Position, ai.target.Position)
+	switch {
+	case distance > ai.Profile.PreferredRange+5:
+		ai.moveTo(g, t, ai.target.Position, in)
+	case distance < ai.Profile.PreferredRange-5:
+		// Back off while keeping the front armor to the target
+		if faceTowards(t, ai.target.Position, in) {
+			in.Backward = true
+		}
+	default:
+		// In range: face the target and settle the aim
+		if faceTowards(t, ai.target.Position, in) {
+			in.Aiming = true
+		}
+	}
+}
+
+func (ai *StateAI) flank(g *Game, t *Tank, in *Input) {
+	if ai.target == nil {
+		ai.search(g, t, in)
+		return
+	}
+
+	// Aim for a spot off the target's side at preferred range
+	side := ai.target.Rotation + math.Pi/2
+	point := ai.target.Position.Add(NewVec3(
+		float32(math.Sin(float64(side)))*ai.flankSide*ai.Profile.PreferredRange,
+		0,
+		float32(math.Cos(float64(side)))*ai.flankSide*ai.Profile.PreferredRange,
+	))
+
+	if distance2D(t.Position, point) < 6 {
+		ai.State = AIEngage
+		return
+	}
+	ai.moveTo(g, t, point, in)
+}
+
+func (ai *StateAI) retreat(g *Game, t *Tank, in *Input) {
+	if distance2D(t.Position, ai.cover) < 3 {
+		if ai.target != nil && faceTowards(t, ai.target.Position, in) {
+			in.Aiming = true
+		}
+		return
+	}
+	ai.moveTo(g, t, ai.cover, in)
+}
+
+// moveTo drives t along a planned route to point, replanning when the
+// destination moves or the route goes stale.
+func (ai *StateAI) moveTo(g *Game, t *Tank, point Vec3, in *Input) {
+	now := g.Clock.Tick
+
+	// Other tanks are not on the grid and can pin us in place; back out at
+	// an angle and plan afresh
+	if now >= ai.progressAt {
+		if ai.progressAt > 0 && now-ai.progressAt < aiReplanTicks && distance2D(t.Position, ai.progressFrom) < 1 {
+			ai.reverseUntil = now + 45
+			ai.reverseTurn = 1
+			if g.rng.Float32() < 0.5 {
+				ai.reverseTurn = -1
+			}
+			ai.path = nil
+		}
+		ai.progressAt, ai.progressFrom = now+aiReplanTicks, t.Position
+	}
+	if now < ai.reverseUntil {
+		in.Backward = true
+		turnTowards(ai.reverseTurn, in)
+		return
+	}
+
+	if ai.path == nil || distance2D(point, ai.pathGoal) > 4 || now >= ai.replanAt {
+		path, ok := g.Nav.FindPath(t.Position, point)
+		if !ok {
+			path = []Vec3{point}
+		}
+		ai.path, ai.pathGoal, ai.replanAt = path, point, now+aiReplanTicks
+	}
+
+	// Waypoints are only passed once reached, so at a sharp corner the tank
+	// pivots on the spot instead of swinging wide into the obstacle
+	for len(ai.path) > 1 && distance2D(t.Position, ai.path[0]) < NavCellSize {
+		ai.path = ai.path[1:]
+	}
+	steerTowards(t, ai.path[0], in)
+}
+
+// aim keeps the turret and gun on the target and fires once the reaction
+// time has passed and the aiming circle is tight enough.
+func (ai *StateAI) aim(g *Game, t *Tank, in *Input) {
+	turretAngle := normalizeAngle(headingTo(t.Position, ai.target.Position) - t.Rotation)
+	in.AimTurret = true
+	in.TurretAngle = turretAngle
+	in.HasAimPoint = true
+	in.AimPoint = ai.target.Position
+
+	onTarget := abs32(normalizeAngle(turretAngle-t.TurretRotation)) < 0.05
+	reacted := g.Clock.Tick-ai.seenAt >= ai.Profile.ReactionTicks
+	steady := t.AimingCircle.CurrentRadius <= ai.Profile.FireThreshold
+	if onTarget && reacted && steady && t.Reloaded(g.Clock.Tick) {
+		in.Fire = true
+	}
+}
+
+// nearestVisibleOpponent returns the closest living opponent of t that t's
+// side has spotted, or nil.
+func (g *Game) nearestVisibleOpponent(t *Tank) *Tank {
+	var nearest *Tank
+	best := float32(math.MaxFloat32)
+	for _, other := range g.Tanks() {
+		if other.Health <= 0 || other.Team == t.Team || !other.Spotted {
+			continue
+		}
+		if distance := distance2D(t.Position, other.Position); distance <= best {
+			nearest, best = other, distance
+		}
+	}
+	return nearest
+}
+
+// coverFrom picks a spot behind the obstacle nearest to position, on the far
+// side from threat. With no obstacles it simply backs away from the threat.
+func (g *Game) coverFrom(position, threat Vec3) Vec3 {
+	var cover *Obstacle
+	best := float32(math.MaxFloat32)
+	for i := range g.Terrain.Obstacles {
+		obstacle := &g.Terrain.Obstacles[i]
+		if distance := distance2D(position, obstacle.Position); distance < best {
+			cover, best = obstacle, distance
+		}
+	}
+
+	if cover == nil {
+		return position.Add(direction2D(threat, position).Scale(20))
+	}
+
+	clearance := float32(math.Max(float64(cover.Size.X), float64(cover.Size.Z)))/2 + 3
+	return cover.Position.Add(direction2D(threat, cover.Position).Scale(clearance))
+}
+
+// steerTowards turns the hull towards point, driving forward once it is
+// roughly facing it.
+func steerTowards(t *Tank, point Vec3, in *Input) {
+	diff := normalizeAngle(headingTo(t.Position, point) - t.Rotation)
+	turnTowards(diff, in)
+	if abs32(diff) < 0.6 {
+		in.Forward = true
+	}
+}
+
+// faceTowards turns the hull towards point and reports whether it already
+// faces it.
+func faceTowards(t *Tank, point Vec3, in *Input) bool {
+	diff := normalizeAngle(headingTo(t.Position, point) - t.Rotation)
+	turnTowards(diff, in)
+	return abs32(diff) <= 0.1
+}
+
+func turnTowards(diff float32, in *Input) {
+	if diff > 0.1 {
+		in.TurnRight = true
+	} else if diff < -0.1 {
+		in.TurnLeft = true
+	}
+}
+
+// headingTo returns the Tank.Rotation that faces from one point to another.
+func headingTo(from, to Vec3) float32 {
+	return float32(math.Atan2(float64(to.X-from.X), float64(to.Z-from.Z)))
+}
+
+func distance2D(a, b Vec3) float32 {
+	return float32(math.Hypot(float64(a.X-b.X), float64(a.Z-b.Z)))
+}
+
+// direction2D returns the unit ground-plane direction from one point to
+// another.
+func direction2D(from, to Vec3) Vec3 {
+	distance := distance2D(from, to)
+	if distance == 0 {
+		return NewVec3(0, 0, 1)
+	}
+	return NewVec3((to.X-from.X)/distance, 0, (to.Z-from.Z)/distance)
+}
@@ -0,0 +1,145 @@
+package sim
+
+import "math"
+
+// RicochetAngle is the impact angle from the armor normal beyond which shells
+// glance off without penetrating.
+const RicochetAngle = 70 * math.Pi / 180
+
+// Armor is plate thickness in millimetres for each part of a tank.
+type Armor struct {
+	Front  float32 `json:"front"`
+	Side   float32 `json:"side"`
+	Rear   float32 `json:"rear"`
+	Turret float32 `json:"turret"`
+}
+
+// HitOutcome is what happened when a shell struck a tank.
+type HitOutcome int
+
+const (
+	Penetrated HitOutcome = iota
+	NotPenetrated
+	Ricochet
+)
+
+func (o HitOutcome) String() string {
+	switch o {
+	case Penetrated:
+		return "Penetration"
+	case NotPenetrated:
+		return "Did not penetrate"
+	case Ricochet:
+		return "Ricochet"
+	}
+	return "Unknown"
+}
+
+// armorHit is a shell crossing a tank's hull or turret.
+type armorHit struct {
+	tank     *Tank
+	fraction float32 // Along the shell's path this tick
+	normal   Vec3    // Outward normal of the struck plate
+	armor    float32 // Nominal thickness of the struck plate
+}
+
+// armorHit sweeps a shell path against the turret and hull boxes and returns
+// the plate it strikes first.
+func (t *Tank) armorHit(from, to Vec3) (armorHit, bool) {
+	best := armorHit{tank: t, fraction: 2}
+
+	turret := Rect{
+		CenterX:    t.Position.X,
+		CenterZ:    t.Position.Z,
+		HalfWidth:  t.TurretWidth / 2,
+		HalfLength: t.TurretLength / 2,
+		Rotation:   t.Rotation + t.TurretRotation,
+	}
+	turretY := t.Position.Y + t.TurretOffset
+	if fraction, normal, hit := turret.SegmentEntry(from, to, turretY-t.TurretHeight/2, turretY+t.TurretHeight/2); hit {
+		best = armorHit{tank: t, fraction: fraction, normal: normal, armor: t.Armor.Turret}
+	}
+
+	hullBottom := t.Position.Y - t.HullHeight/2
+	if fraction, normal, hit := t.Footprint().SegmentEntry(from, to, hullBottom, hullBottom+t.HullHeight); hit && fraction < best.fraction {
+		best = armorHit{tank: t, fraction: fraction, normal: normal, armor: t.hullArmor(normal)}
+	}
+
+	return best, best.fraction <= 1
+}
+
+// hullArmor picks the hull plate facing the given outward normal. The thin
+// roof and belly count as rear armor.
+func (t *Tank) hullArmor(normal Vec3) float32 {
+	forward := float32(math.Sin(float64(t.Rotation)))*normal.X + float32(math.Cos(float64(t.Rotation)))*normal.Z
+	switch {
+	case normal.Y > 0.5 || normal.Y < -0.5:
+		return t.Armor.Rear
+	case forward > 0.5:
+		return t.Armor.Front
+	case forward < -0.5:
+		return t.Armor.Rear
+	}
+	return t.Armor.Side
+}
+
+// shellHit finds the first tank the shell struck this tick. Without
+// friendly fire, shells pass through the shooter's allies. A shell fired
+// by a lagging tank is checked against where its targets stood as the
+// shooter saw them.
+func (g *Game) shellHit(b *Bullet, from, to Vec3) (armorHit, bool) {
+	best := armorHit{fraction: 2}
+	for i, t := range g.Tanks() {
+		if t.Health <= 0 || t == b.Shooter || (t.Team == b.Team && !g.config.FriendlyFire) {
+			continue
+		}
+		target := t
+		if b.Rewind > 0 && g.history != nil {
+			target = g.rewound(t, i, b.Rewind)
+		}
+		if hit, ok := target.armorHit(from, to); ok && hit.fraction < best.fraction {
+			hit.tank = t
+			best = hit
+		}
+	}
+	return best, best.fraction <= 1
+}
+
+// resolveHit decides whether a shell penetrates the struck plate. Angled
+// plates are effectively thicker, steep hits ricochet, and both penetration
+// and damage vary by ±25% per shot.
+func (g *Game) resolveHit(b *Bullet, hit armorHit, point Vec3) {
+	outcome := NotPenetrated
+	damage := 0
+
+	// Cosine of the angle between the shell's path and the plate normal
+	impactCos := float32(1)
+	if hit.normal != (Vec3{}) {
+		speed := float32(math.Sqrt(float64(b.Velocity.X*b.Velocity.X + b.Velocity.Y*b.Velocity.Y + b.Velocity.Z*b.Velocity.Z)))
+		if speed > 0 {
+			impactCos = -(b.Velocity.X*hit.normal.X + b.Velocity.Y*hit.normal.Y + b.Velocity.Z*hit.normal.Z) / speed
+		}
+	}
+
+	if impactCos < float32(math.Cos(RicochetAngle)) {
+		outcome = Ricochet
+	} else {
+		effectiveArmor := hit.armor / impactCos
+		penetration := b.Penetration * (0.75 + g.rng.Float32()*0.5)
+		if penetration > effectiveArmor {
+			outcome = Penetrated
+			damage = int(float32(b.Damage)*(0.75+g.rng.Float32()*0.5) + 0.5)
+			hit.tank.TakeDamage(damage)
+			g.damaged[hit.tank] = true
+		}
+	}
+
+	g.emit(Event{
+		Kind:     EventTankHit,
+		Position: point,
+		Tank:     hit.tank,
+		Shooter:  b.Shooter,
+		Outcome:  outcome,
+		Damage:   damage,
+	})
+}
@@ -0,0 +1,36 @@
+package sim
+
+import "math"
+
+const (
+	// Gravity pulls shells down by this many world units per tick, per tick.
+	Gravity = 0.002
+	// GroundLevel is the height of the ground plane tanks drive on.
+	GroundLevel = -0.5
+)
+
+// ElevationTo returns the gun elevation, in radians above the horizontal,
+// that drops a shell fired at muzzleVelocity from "from" onto target. It
+// picks the flatter of the two possible arcs. Targets out of range get the
+// 45 degree angle that reaches furthest.
+func ElevationTo(from, target Vec3, muzzleVelocity float32) float32 {
+	dx := float64(target.X - from.X)
+	dz := float64(target.Z - from.Z)
+	distance := math.Hypot(dx, dz)
+	height := float64(target.Y - from.Y)
+	v2 := float64(muzzleVelocity * muzzleVelocity)
+
+	if distance < 1e-3 {
+		if height >= 0 {
+			return math.Pi / 2
+		}
+		return -math.Pi / 2
+	}
+
+	discriminant := v2*v2 - Gravity*(Gravity*distance*distance+2*height*v2)
+	if discriminant < 0 {
+		return math.Pi / 4
+	}
+
+	return float32(math.Atan((v2 - math.Sqrt(discriminant)) / (Gravity * distance)))
+}
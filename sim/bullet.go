@@ -0,0 +1,46 @@
+package sim
+
+import (
+	"math"
+	"time"
+)
+
+type Bullet struct {
+	Position    Vec3
+	Velocity    Vec3
+	Speed       float32
+	LifeTime    int  // Remaining ticks
+	Team        Team // Team of the tank that fired it
+	Shooter     *Tank
+	Rewind      int     // Ticks into the past targets are checked at, for lag compensation
+	Penetration float32 // Millimetres of armor at a flat angle
+	Damage      int
+}
+
+// NewBullet fires a shell heading along angle (around Y) and elevation
+// (above the horizontal) at the given muzzle speed.
+func NewBullet(position Vec3, angle, elevation, speed float32, team Team) *Bullet {
+	horizontal := float32(math.Cos(float64(elevation))) * speed
+
+	velocity := NewVec3(
+		float32(math.Sin(float64(angle)))*horizontal,
+		float32(math.Sin(float64(elevation)))*speed,
+		float32(math.Cos(float64(angle)))*horizontal,
+	)
+
+	return &Bullet{
+		Position: position,
+		Velocity: velocity,
+		Speed:    speed,
+		LifeTime: Ticks(5 * time.Second),
+		Team:     team,
+	}
+}
+
+func (b *Bullet) Update() {
+	b.Velocity.Y -= Gravity
+	b.Position.X += b.Velocity.X
+	b.Position.Y += b.Velocity.Y
+	b.Position.Z += b.Velocity.Z
+	b.LifeTime--
+}
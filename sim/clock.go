@@ -0,0 +1,46 @@
+package sim
+
+import "time"
+
+// maxFrameTime caps how much simulated time a single slow frame may catch up.
+const maxFrameTime = 0.25
+
+// Clock is the single source of time for the simulation. Reloads, bullet
+// lifetimes, AI timers and the aiming circle all count its ticks, so pausing
+// or scaling it affects them together.
+type Clock struct {
+	Tick   int     // Ticks simulated so far
+	Scale  float32 // Simulated seconds per real second
+	Paused bool
+
+	accumulator float32
+}
+
+func NewClock() Clock {
+	return Clock{Scale: 1}
+}
+
+// Advance adds real elapsed time to the clock and returns how many ticks the
+// caller should step to catch up.
+func (c *Clock) Advance(realSeconds float32) int {
+	if c.Paused {
+		return 0
+	}
+
+	c.accumulator += realSeconds * c.Scale
+	if c.accumulator > maxFrameTime*c.Scale {
+		c.accumulator = maxFrameTime * c.Scale
+	}
+
+	ticks := 0
+	for c.accumulator >= TickDuration {
+		c.accumulator -= TickDuration
+		ticks++
+	}
+	return ticks
+}
+
+// Ticks converts a duration to a whole number of simulation ticks.
+func Ticks(d time.Duration) int {
+	return int(d * TickRate / time.Second)
+}
@@ -0,0 +1,276 @@
+package sim
+
+import "math"
+
+// Rect is an oriented rectangle on the ground (XZ) plane. Rotation follows
+// the Tank.Rotation convention: local +Z points along (sin r, cos r).
+type Rect struct {
+	CenterX    float32
+	CenterZ    float32
+	HalfWidth  float32 // Half extent along local X
+	HalfLength float32 // Half extent along local Z
+	Rotation   float32
+}
+
+// axes returns the rectangle's local X and Z axes in world space.
+func (r Rect) axes() (x, z [2]float32) {
+	sin := float32(math.Sin(float64(r.Rotation)))
+	cos := float32(math.Cos(float64(r.Rotation)))
+	return [2]float32{cos, -sin}, [2]float32{sin, cos}
+}
+
+// radius returns the radius of the circle enclosing the rectangle.
+func (r Rect) radius() float32 {
+	return float32(math.Hypot(float64(r.HalfWidth), float64(r.HalfLength)))
+}
+
+// contains reports whether the ground point (x, z) lies inside r.
+func (r Rect) contains(x, z float32) bool {
+	ax, az := r.axes()
+	dx, dz := x-r.CenterX, z-r.CenterZ
+	return abs32(dx*ax[0]+dz*ax[1]) <= r.HalfWidth && abs32(dx*az[0]+dz*az[1]) <= r.HalfLength
+}
+
+// projectedHalf returns half the length of r's shadow on axis n.
+func (r Rect) projectedHalf(n [2]float32) float32 {
+	x, z := r.axes()
+	return abs32(x[0]*n[0]+x[1]*n[1])*r.HalfWidth + abs32(z[0]*n[0]+z[1]*n[1])*r.HalfLength
+}
+
+// Penetration tests r against other with the separating axis theorem. When
+// they overlap it returns the shortest vector that moves r out of other.
+func (r Rect) Penetration(other Rect) (dx, dz float32, overlapping bool) {
+	centerX := other.CenterX - r.CenterX
+	centerZ := other.CenterZ - r.CenterZ
+
+	reach := r.radius() + other.radius()
+	if centerX*centerX+centerZ*centerZ >= reach*reach {
+		return 0, 0, false
+	}
+
+	rx, rz := r.axes()
+	ox, oz := other.axes()
+
+	minOverlap := float32(math.MaxFloat32)
+	for _, n := range [][2]float32{rx, rz, ox, oz} {
+		distance := centerX*n[0] + centerZ*n[1]
+		overlap := r.projectedHalf(n) + other.projectedHalf(n) - abs32(distance)
+		if overlap <= 0 {
+			return 0, 0, false
+		}
+		if overlap < minOverlap {
+			minOverlap = overlap
+			// Push r away from other's center
+			sign := float32(-1)
+			if distance < 0 {
+				sign = 1
+			}
+			dx, dz = n[0]*overlap*sign, n[1]*overlap*sign
+		}
+	}
+
+	return dx, dz, true
+}
+
+// collideWithTerrain pushes a tank out of any obstacle it overlaps. Only the
+// component of motion into an obstacle is removed, so tanks slide along walls
+// instead of stopping dead. Obstacles the tank has just run into are rammed.
+func (g *Game) collideWithTerrain(t *Tank) {
+	type ram struct {
+		contact obstacleContact
+		dx, dz  float32
+	}
+	var rams []ram
+
+	g.pushOut(t, func(obstacle Obstacle, dx, dz float32) {
+		contact := obstacleContact{tank: t, at: obstacle.Position}
+		if !g.touching[contact] && !g.touched[contact] {
+			rams = append(rams, ram{contact, dx, dz})
+		}
+		g.touching[contact] = true
+	})
+
+	// Obstacles can fall while ramming, so find each again by position
+	for _, r := range rams {
+		for i, obstacle := range g.Terrain.Obstacles {
+			if obstacle.Position == r.contact.at {
+				g.ramObstacle(t, i, r.dx, r.dz)
+				break
+			}
+		}
+	}
+}
+
+// pushOut slides a tank out of the obstacles it overlaps, calling hit (if
+// not nil) with each obstacle and the push it gave.
+func (g *Game) pushOut(t *Tank, hit func(obstacle Obstacle, dx, dz float32)) {
+	// A few passes settle tanks wedged between neighbouring obstacles
+	for pass := 0; pass < 4; pass++ {
+		moved := false
+		for _, obstacle := range g.Terrain.Obstacles {
+			dx, dz, overlap := t.Footprint().Penetration(obstacle.Footprint())
+			if !overlap {
+				continue
+			}
+			t.Position.X += dx
+			t.Position.Z += dz
+			moved = true
+			if hit != nil {
+				hit(obstacle, dx, dz)
+			}
+		}
+		if !moved {
+			break
+		}
+	}
+}
+
+func abs32(v float32) float32 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// SegmentHit sweeps the segment from→to through the box standing on r
+// between heights bottom and top. It returns the fraction along the segment
+// where it first enters the box.
+func (r Rect) SegmentHit(from, to Vec3, bottom, top float32) (float32, bool) {
+	fraction, _, hit := r.SegmentEntry(from, to, bottom, top)
+	return fraction, hit
+}
+
+// SegmentEntry is SegmentHit that also returns the outward normal of the
+// face the segment enters through. The normal is zero when the segment
+// starts inside the box.
+func (r Rect) SegmentEntry(from, to Vec3, bottom, top float32) (float32, Vec3, bool) {
+	// Move the segment into the rectangle's local frame
+	x, z := r.axes()
+	localX := func(p Vec3) float32 { return (p.X-r.CenterX)*x[0] + (p.Z-r.CenterZ)*x[1] }
+	localZ := func(p Vec3) float32 { return (p.X-r.CenterX)*z[0] + (p.Z-r.CenterZ)*z[1] }
+
+	start := [3]float32{localX(from), from.Y, localZ(from)}
+	end := [3]float32{localX(to), to.Y, localZ(to)}
+	min := [3]float32{-r.HalfWidth, bottom, -r.HalfLength}
+	max := [3]float32{r.HalfWidth, top, r.HalfLength}
+
+	// Slab test against the now axis-aligned box
+	enter, exit := float32(0), float32(1)
+	face, faceSign := -1, float32(0)
+	for i := 0; i < 3; i++ {
+		delta := end[i] - start[i]
+		if delta == 0 {
+			if start[i] < min[i] || start[i] > max[i] {
+				return 0, Vec3{}, false
+			}
+			continue
+		}
+
+		t0 := (min[i] - start[i]) / delta
+		t1 := (max[i] - start[i]) / delta
+		sign := float32(-1) // Entering through the min face
+		if t0 > t1 {
+			t0, t1 = t1, t0
+			sign = 1
+		}
+		if t0 > enter {
+			enter = t0
+			face, faceSign = i, sign
+		}
+		if t1 < exit {
+			exit = t1
+		}
+		if enter > exit {
+			return 0, Vec3{}, false
+		}
+	}
+
+	var normal Vec3
+	switch face {
+	case 0:
+		normal = NewVec3(x[0]*faceSign, 0, x[1]*faceSign)
+	case 1:
+		normal = NewVec3(0, faceSign, 0)
+	case 2:
+		normal = NewVec3(z[0]*faceSign, 0, z[1]*faceSign)
+	}
+
+	return enter, normal, true
+}
+
+// collideTanks separates overlapping tanks. The push is split by mass so a
+// heavier tank shoves a lighter one aside, and new contacts deal ramming
+// damage proportional to the speed at which the tanks closed.
+func (g *Game) collideTanks() {
+	tanks := make([]*Tank, 0, len(g.Enemies)+1)
+	for _, t := range g.Tanks() {
+		if t.Health > 0 {
+			tanks = append(tanks, t)
+		}
+	}
+
+	contacts := make(map[[2]*Tank]bool)
+	for i, a := range tanks {
+		for _, b := range tanks[i+1:] {
+			dx, dz, hit := a.Footprint().Penetration(b.Footprint())
+			if !hit {
+				continue
+			}
+
+			pair := [2]*Tank{a, b}
+			contacts[pair] = true
+			if !g.contacts[pair] {
+				g.ram(a, b, dx, dz)
+			}
+
+			// The lighter tank takes the larger share of the push
+			share := b.Mass / (a.Mass + b.Mass)
+			a.Position.X += dx * share
+			a.Position.Z += dz * share
+			b.Position.X -= dx * (1 - share)
+			b.Position.Z -= dz * (1 - share)
+
+			// Don't let the push shove either tank into cover
+			g.collideWithTerrain(a)
+			g.collideWithTerrain(b)
+		}
+	}
+	g.contacts = contacts
+}
+
+// ram applies collision damage when a and b first touch. (dx, dz) is the
+// direction that separates a from b.
+func (g *Game) ram(a, b *Tank, dx, dz float32) {
+	if g.ramDamage <= 0 || (a.Team == b.Team && !g.config.FriendlyFire) {
+		return
+	}
+
+	length := float32(math.Hypot(float64(dx), float64(dz)))
+	if length == 0 {
+		return
+	}
+
+	// Speed at which the tanks were approaching along the contact normal
+	relative := a.Velocity.Sub(b.Velocity)
+	closing := -(relative.X*dx + relative.Z*dz) / length
+	if closing <= 0 {
+		return
+	}
+
+	// Each tank suffers in proportion to the other's share of the mass
+	total := a.Mass + b.Mass
+	impact := closing * g.ramDamage
+	point := a.Position.Add(b.Position).Scale(0.5)
+	for _, hit := range []struct {
+		tank  *Tank
+		share float32
+	}{{a, b.Mass / total}, {b, a.Mass / total}} {
+		damage := int(impact * hit.share)
+		if damage <= 0 {
+			continue
+		}
+		hit.tank.TakeDamage(damage)
+		g.damaged[hit.tank] = true
+		g.emit(Event{Kind: EventRam, Position: point, Tank: hit.tank, Damage: damage})
+	}
+}
@@ -0,0 +1,117 @@
+package sim
+
+import "math"
+
+// ObstacleType is how sturdy a kind of obstacle is and what it leaves
+// behind.
+type ObstacleType struct {
+	// Health is the structural damage the obstacle takes before it is
+	// destroyed; zero can't be destroyed.
+	Health int
+	// Rubble is the type that replaces the obstacle when it is destroyed.
+	// Without it the obstacle falls over and becomes debris.
+	Rubble string
+}
+
+// ObstacleTypes are the obstacles generated terrain and maps can place.
+var ObstacleTypes = map[string]ObstacleType{
+	"building": {Health: 150, Rubble: "rubble"},
+	"tree":     {Health: 10},
+	"rubble":   {},
+}
+
+// rubbleHeight is the share of a building's height left standing when it
+// collapses.
+const rubbleHeight = 0.25
+
+// obstacleRamDamage is the structural damage per unit of closing speed
+// (world units per tick) a medium tank does driving into an obstacle: a
+// tree falls to one at full speed and a building takes several. It holds
+// whatever Config.RamDamage says about tanks ramming each other.
+const obstacleRamDamage = 100
+
+// obstacleContact is a tank touching an obstacle, identified by where it
+// stands since obstacles shift in Terrain.Obstacles as others are removed.
+type obstacleContact struct {
+	tank *Tank
+	at   Vec3
+}
+
+// ramObstacle damages an obstacle a tank has just driven into, in
+// proportion to its closing speed and mass like a ram between two tanks.
+// (dx, dz) is the direction that pushes the tank out.
+func (g *Game) ramObstacle(t *Tank, index int, dx, dz float32) {
+	length := float32(math.Hypot(float64(dx), float64(dz)))
+	if length == 0 {
+		return
+	}
+	closing := -(t.Velocity.X*dx + t.Velocity.Z*dz) / length
+	if closing <= 0 {
+		return
+	}
+
+	damage := int(closing * obstacleRamDamage * t.Mass / DefaultTankClass().Mass)
+	g.damageObstacle(index, damage, NewVec3(-dx/length, 0, -dz/length))
+}
+
+// damageObstacle takes damage off an obstacle's structure, destroying it
+// once nothing is left. direction is the way the blow pushed, which is
+// where a tree falls.
+func (g *Game) damageObstacle(index, damage int, direction Vec3) {
+	obstacle := &g.Terrain.Obstacles[index]
+	if damage <= 0 || ObstacleTypes[obstacle.Type].Health == 0 {
+		return
+	}
+	obstacle.Health -= damage
+	if obstacle.Health > 0 {
+		return
+	}
+	g.destroyObstacle(index, direction)
+}
+
+// DestroyObstacle brings down the destructible obstacle standing at a
+// position, as if struck from direction, so a copy of a match can follow
+// the destruction reported by the one that owns it. It reports whether
+// there was such an obstacle.
+func (g *Game) DestroyObstacle(at, direction Vec3) bool {
+	for i, obstacle := range g.Terrain.Obstacles {
+		if obstacle.Position == at && ObstacleTypes[obstacle.Type].Health > 0 {
+			g.destroyObstacle(i, direction)
+			return true
+		}
+	}
+	return false
+}
+
+func (g *Game) destroyObstacle(index int, direction Vec3) {
+	obstacle := &g.Terrain.Obstacles[index]
+	destroyed := *obstacle
+	if rubble := ObstacleTypes[destroyed.Type].Rubble; rubble != "" {
+		// Collapse into a low heap over the same ground
+		*obstacle = Obstacle{
+			Position: destroyed.Position,
+			Size:     NewVec3(destroyed.Size.X, destroyed.Size.Y*rubbleHeight, destroyed.Size.Z),
+			Rotation: destroyed.Rotation,
+			Type:     rubble,
+			Health:   ObstacleTypes[rubble].Health,
+		}
+	} else {
+		g.Terrain.Obstacles = append(g.Terrain.Obstacles[:index], g.Terrain.Obstacles[index+1:]...)
+		g.Terrain.Debris = append(g.Terrain.Debris, fallen(destroyed, direction))
+	}
+
+	g.Nav.Refresh(g.Terrain, destroyed.Footprint())
+	g.emit(Event{Kind: EventObstacleDestroyed, Position: destroyed.Position, Direction: direction, Obstacle: &destroyed})
+}
+
+// fallen lays an obstacle on its side, toppled in direction: its height
+// becomes its length along the ground.
+func fallen(o Obstacle, direction Vec3) Obstacle {
+	heading := float32(math.Atan2(float64(direction.X), float64(direction.Z)))
+	return Obstacle{
+		Position: o.Position.Add(NewVec3(direction.X, 0, direction.Z).Scale(o.Size.Y / 2)),
+		Size:     NewVec3(o.Size.X, o.Size.X, o.Size.Y),
+		Rotation: heading,
+		Type:     o.Type,
+	}
+}
@@ -0,0 +1,61 @@
+package sim
+
+import (
+	"math"
+	"testing"
+)
+
+// TestRamTreeWithoutRamDamage drives into a tree in a match where tanks
+// can't hurt each other by ramming; the tree still comes down.
+func TestRamTreeWithoutRamDamage(t *testing.T) {
+	g := NewGame(Config{Seed: 1, Mode: "skirmish"})
+	player := g.Player
+	ahead := NewVec3(float32(math.Sin(float64(player.Rotation))), 0, float32(math.Cos(float64(player.Rotation))))
+	tree := player.Position.Add(ahead.Scale(6))
+	g.Terrain.Obstacles = []Obstacle{{
+		Position: NewVec3(tree.X, g.Terrain.HeightAt(tree.X, tree.Z), tree.Z),
+		Size:     NewVec3(1, 6, 1),
+		Type:     "tree",
+		Health:   ObstacleTypes["tree"].Health,
+	}}
+	g.Nav = NewNavGrid(g.Terrain)
+
+	for tick := 0; tick < Ticks(DefaultCountdown)+3*TickRate; tick++ {
+		g.Step(Input{Forward: true})
+		if len(g.Terrain.Obstacles) == 0 {
+			if len(g.Terrain.Debris) != 1 {
+				t.Errorf("tree left %d pieces of debris, want 1", len(g.Terrain.Debris))
+			}
+			return
+		}
+	}
+	t.Fatalf("tree still standing with %d health", g.Terrain.Obstacles[0].Health)
+}
+
+// TestRamTreeFromRest pulls away from a standstill straight into a tree,
+// which the first tick of movement knocks down.
+func TestRamTreeFromRest(t *testing.T) {
+	cfg := testConfig(1, "skirmish")
+	cfg.Countdown = 0
+	g := NewGame(cfg)
+	player := g.Player
+	ahead := NewVec3(float32(math.Sin(float64(player.Rotation))), 0, float32(math.Cos(float64(player.Rotation))))
+	// Just out of reach of the hull's nose, closer than a tick's drive
+	tree := player.Position.Add(ahead.Scale(player.HullLength/2 + 0.5 + player.Speed/2))
+	g.Terrain.Obstacles = []Obstacle{{
+		Position: NewVec3(tree.X, g.Terrain.HeightAt(tree.X, tree.Z), tree.Z),
+		Size:     NewVec3(1, 6, 1),
+		Type:     "tree",
+		Health:   ObstacleTypes["tree"].Health,
+	}}
+	g.Nav = NewNavGrid(g.Terrain)
+
+	g.Step(Input{})
+	if len(g.Terrain.Obstacles) != 1 {
+		t.Fatal("tree fell before the tank moved")
+	}
+	g.Step(Input{Forward: true})
+	if len(g.Terrain.Obstacles) != 0 {
+		t.Errorf("tree still standing with %d health", g.Terrain.Obstacles[0].Health)
+	}
+}
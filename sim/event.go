@@ -0,0 +1,48 @@
+package sim
+
+type EventKind int
+
+const (
+	// EventImpact is a shell stopped by an obstacle.
+	EventImpact EventKind = iota
+	// EventTankHit is a shell striking a tank.
+	EventTankHit
+	// EventRam is a tank taking damage from a collision with another tank.
+	EventRam
+	// EventCaptureReset is a base capture knocked back to zero by damage to
+	// a capturing tank.
+	EventCaptureReset
+	// EventObstacleDestroyed is a tree felled or a building collapsed by
+	// shells or ramming.
+	EventObstacleDestroyed
+)
+
+// Event reports something that happened during a tick, for the renderer or
+// other observers to react to.
+type Event struct {
+	Kind     EventKind
+	Tick     int
+	Position Vec3
+	Tank     *Tank // Tank that was hit, if any
+
+	// Shell hits report the outcome back to the shooter
+	Shooter *Tank
+	Outcome HitOutcome
+	Damage  int // Health taken from Tank by a hit or ram
+
+	Obstacle  *Obstacle // Obstacle destroyed, as it stood
+	Direction Vec3      // Way the blow that destroyed it pushed
+}
+
+func (g *Game) emit(e Event) {
+	e.Tick = g.Clock.Tick
+	g.events = append(g.events, e)
+}
+
+// DrainEvents returns the events raised since the last call and clears them.
+// Callers that care about events should drain them after every update.
+func (g *Game) DrainEvents() []Event {
+	events := g.events
+	g.events = nil
+	return events
+}
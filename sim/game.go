@@ -0,0 +1,542 @@
+// Package sim is the headless game simulation. It owns the tanks, bullets and
+// terrain and advances them one fixed tick at a time from an explicit Input,
+// so matches can run without a window or GPU.
+package sim
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+const (
+	MapSize = 100.0
+	// MaxMapSize is half the width of the largest map a file may describe,
+	// which keeps the terrain and navigation grid of any map in bounds.
+	MaxMapSize = 500.0
+
+	// TickRate is the number of simulation steps per simulated second.
+	TickRate = 60
+	// TickDuration is the length of one simulation step in seconds.
+	TickDuration = 1.0 / TickRate
+)
+
+// Input is everything the player can do during one tick.
+type Input struct {
+	Forward     bool
+	Backward    bool
+	TurnLeft    bool
+	TurnRight   bool
+	TurretLeft  bool
+	TurretRight bool
+
+	// TurretAngle sets the turret rotation directly when AimTurret is true
+	// (mouse aiming), relative to the hull.
+	AimTurret   bool
+	TurretAngle float32
+
+	// GunUp and GunDown elevate the gun by hand (keyboard aiming).
+	GunUp   bool
+	GunDown bool
+
+	// AimPoint is the world point under the crosshair. When HasAimPoint is
+	// set the gun elevates to drop shells onto it.
+	HasAimPoint bool
+	AimPoint    Vec3
+
+	Aiming bool // Right mouse button held
+	Fire   bool
+}
+
+// Config holds the parameters a match is created from.
+type Config struct {
+	// Seed drives every random roll in the match: terrain generation, shot
+	// spread and AI decisions. Two games with the same seed and the same
+	// inputs play out identically.
+	Seed int64
+
+	// RamDamage is the damage dealt per unit of closing speed (world units
+	// per tick) when two tanks collide. Zero disables ramming damage.
+	RamDamage float32
+
+	// PlayerClass is the player's tank. AllyClasses and EnemyClasses are
+	// assigned to the AI tanks on each team in turn. Classes without a name
+	// fall back to DefaultTankClass.
+	PlayerClass  TankClass
+	AllyClasses  []TankClass
+	EnemyClasses []TankClass
+
+	// Difficulty names the AIProfile AI tanks use; empty means normal.
+	Difficulty string
+
+	// Mode names the BattleMode; empty means skirmish.
+	Mode string
+
+	// FriendlyFire lets shells and rams damage tanks on the same team.
+	// Without it shells pass through allies.
+	FriendlyFire bool
+
+	// Heightmap is the ground to fight on; nil raises hills from the seed.
+	// It is stored in full so replays don't depend on the image file.
+	Heightmap *Heightmap
+
+	// Map is a hand-authored battlefield to fight on instead of a generated
+	// one. It replaces Heightmap and the generated obstacles, spawns and
+	// bases.
+	Map *Map
+
+	// PlayerAI hands the player's tank to an AI controller, as a dedicated
+	// server does until someone takes it over.
+	PlayerAI bool
+
+	// MaxRewind caps how far back shells from tanks with Latency are
+	// checked against where their targets stood, so a slow connection
+	// can't reach far into the past. Zero turns lag compensation off.
+	MaxRewind time.Duration
+
+	// Countdown holds every tank in place before the battle starts.
+	// TimeLimit ends the battle in a draw; zero means no limit.
+	Countdown time.Duration
+	TimeLimit time.Duration
+}
+
+const (
+	DefaultCountdown = 5 * time.Second
+	DefaultTimeLimit = 10 * time.Minute
+	DefaultMaxRewind = 250 * time.Millisecond
+)
+
+// NewSeed picks a seed from the clock, kept short enough to read off the
+// HUD.
+func NewSeed() int64 {
+	return time.Now().UnixNano()%1000000 + 1
+}
+
+// DefaultRamDamage makes a full-speed ram between two equal medium tanks
+// cost each about 10 health.
+const DefaultRamDamage = 100
+
+// aiClass returns the class of a team's i-th AI tank.
+func (cfg Config) aiClass(team Team, i int) TankClass {
+	classes := cfg.EnemyClasses
+	if team == PlayerTeam {
+		classes = cfg.AllyClasses
+	}
+	if len(classes) == 0 {
+		return DefaultTankClass()
+	}
+	return orDefault(classes[i%len(classes)])
+}
+
+func orDefault(class TankClass) TankClass {
+	if class.Name == "" {
+		return DefaultTankClass()
+	}
+	return class
+}
+
+type Game struct {
+	Seed    int64
+	Player  *Tank
+	Allies  []*Tank // AI tanks on the player's team
+	Enemies []*Tank
+	Bullets []*Bullet
+	Terrain *Terrain
+	Nav     *NavGrid
+	Zones   []*CaptureZone // One base per team
+	Clock   Clock
+	Match   Match
+
+	Environment Environment
+
+	config    Config
+	rng       *rand.Rand
+	recording *Replay
+	events    []Event
+	ramDamage float32
+	contacts  map[[2]*Tank]bool
+	damaged   map[*Tank]bool // Tanks hurt this tick, which holds up their base capture
+	maxRewind int            // Ticks
+	history   []poseFrame    // Ring of recent tank poses, for lag compensation
+
+	// Obstacles touched by tanks this tick and the last, so only new
+	// contacts ram
+	touching, touched map[obstacleContact]bool
+}
+
+// AimingCircle is a tank's dispersion: it shrinks while the tank holds still
+// and aims, and blooms when it moves, turns or fires.
+type AimingCircle struct {
+	CurrentRadius float32
+	MinRadius     float32
+	MaxRadius     float32
+	ShrinkSpeed   float32
+	ExpandSpeed   float32
+	IsAiming      bool
+}
+
+func NewAimingCircle() AimingCircle {
+	return AimingCircle{
+		CurrentRadius: 50.0,
+		MinRadius:     20.0,
+		MaxRadius:     80.0,
+		ShrinkSpeed:   1.5,
+		ExpandSpeed:   2.0,
+		IsAiming:      false,
+	}
+}
+
+func NewGame(cfg Config) *Game {
+	rng := rand.New(rand.NewSource(cfg.Seed))
+
+	mode := battleMode(cfg.Mode)
+	profile := aiProfile(cfg.Difficulty)
+
+	// Classic skirmish: the player alone in the middle of three enemies
+	size := float32(MapSize)
+	playerSpawns := []Vec3{NewVec3(0, 0, 0)}
+	enemySpawns := []Vec3{
+		NewVec3(20, 0, 20),
+		NewVec3(-20, 0, 20),
+		NewVec3(30, 0, -10),
+	}
+	heading := func(team Team, spawn Vec3) float32 { return teamHeading(team) }
+	objective := func(team Team, spawn Vec3) Vec3 { return NewVec3(spawn.X, 0, -spawn.Z) }
+	if mode.TeamSize > 0 {
+		playerSpawns = teamSpawns(PlayerTeam, mode.TeamSize)
+		enemySpawns = teamSpawns(EnemyTeam, mode.TeamSize)
+	}
+	if m := cfg.Map; m != nil {
+		size = m.Size
+		playerSpawns = m.spawns(PlayerTeam, len(playerSpawns))
+		enemySpawns = m.spawns(EnemyTeam, len(enemySpawns))
+		// Face the middle of the map, where the fighting is
+		heading = func(team Team, spawn Vec3) float32 {
+			return float32(math.Atan2(float64(-spawn.X), float64(-spawn.Z)))
+		}
+		objective = func(team Team, spawn Vec3) Vec3 { return m.objective(team) }
+	}
+
+	player := NewTank(orDefault(cfg.PlayerClass), playerSpawns[0], PlayerTeam)
+	player.IsPlayer = true
+	if cfg.Map != nil {
+		player.Rotation = heading(PlayerTeam, player.Position)
+	}
+
+	route := func(team Team, spawn Vec3) []Vec3 {
+		route := patrolRoute(rng, spawn, size)
+		if mode.TeamSize > 0 {
+			route = advanceRoute(rng, spawn, objective(team, spawn), size)
+		}
+		return route
+	}
+	spawnAI := func(team Team, spawns []Vec3) []*Tank {
+		tanks := make([]*Tank, 0, len(spawns))
+		for i, spawn := range spawns {
+			t := NewTank(cfg.aiClass(team, i), spawn, team)
+			if mode.TeamSize > 0 || cfg.Map != nil {
+				t.Rotation = heading(team, spawn)
+			}
+			t.Controller = NewStateAI(profile, route(team, spawn))
+			tanks = append(tanks, t)
+		}
+		return tanks
+	}
+	allies := spawnAI(PlayerTeam, playerSpawns[1:])
+	enemies := spawnAI(EnemyTeam, enemySpawns)
+
+	var terrain *Terrain
+	zones := teamBases()
+	environment := DefaultEnvironment()
+	if m := cfg.Map; m != nil {
+		terrain = m.Terrain()
+		zones = m.zones()
+		environment = m.Environment
+	} else {
+		ground := cfg.Heightmap
+		if ground == nil {
+			ground = NewHeightmap(rng)
+		}
+		terrain = NewTerrain(rng, ground)
+	}
+
+	// Planned last so the rest of the match is the same as with a player
+	if cfg.PlayerAI {
+		player.Controller = NewStateAI(profile, route(PlayerTeam, player.Position))
+	}
+
+	g := &Game{
+		Seed:      cfg.Seed,
+		Player:    player,
+		Allies:    allies,
+		Enemies:   enemies,
+		Bullets:   make([]*Bullet, 0),
+		Terrain:   terrain,
+		Nav:       NewNavGrid(terrain),
+		Zones:     zones,
+		Clock:     NewClock(),
+		Match:     newMatch(cfg),
+		config:    cfg,
+		rng:       rng,
+		ramDamage: cfg.RamDamage,
+		contacts:  make(map[[2]*Tank]bool),
+		damaged:   make(map[*Tank]bool),
+		maxRewind: Ticks(cfg.MaxRewind),
+		touching:  make(map[obstacleContact]bool),
+
+		Environment: environment,
+	}
+	// Nudge anyone who spawned inside a building out of it
+	for _, t := range g.Tanks() {
+		g.collideWithTerrain(t)
+		g.settle(t)
+	}
+	g.updateSpotting()
+
+	return g
+}
+
+// patrolRoute scatters a few waypoints around a spawn point, within a map
+// spanning -size to size.
+func patrolRoute(rng *rand.Rand, spawn Vec3, size float32) []Vec3 {
+	waypoints := make([]Vec3, 0, 4)
+	for i := 0; i < 4; i++ {
+		waypoints = append(waypoints, NewVec3(
+			clamp(spawn.X+(rng.Float32()-0.5)*60, -size+5, size-5),
+			0,
+			clamp(spawn.Z+(rng.Float32()-0.5)*60, -size+5, size-5),
+		))
+	}
+	return waypoints
+}
+
+// Update advances the clock by realSeconds of wall time and steps the
+// simulation as many ticks as that covers. Edge-triggered input such as Fire
+// is only applied on the first tick. It returns the number of ticks stepped.
+func (g *Game) Update(realSeconds float32, in Input) int {
+	ticks := g.Clock.Advance(realSeconds)
+	for i := 0; i < ticks; i++ {
+		g.Step(in)
+		in.Fire = false
+	}
+	return ticks
+}
+
+// Record starts capturing the input of every following tick into a replay.
+// Call it before the first Step so the replay covers the whole match.
+func (g *Game) Record() *Replay {
+	g.recording = &Replay{Config: g.config}
+	return g.recording
+}
+
+// Step advances the simulation by one tick using the given player input.
+// Tanks hold still during the countdown, and once the match is over nothing
+// moves.
+func (g *Game) Step(in Input) {
+	if g.recording != nil {
+		g.recording.Inputs = append(g.recording.Inputs, in)
+	}
+	if g.Over() {
+		return
+	}
+
+	g.Clock.Tick++
+	clear(g.damaged)
+	g.updateMatch()
+	if g.Match.Phase == MatchCountdown {
+		return
+	}
+
+	tanks := g.Tanks()
+	start := make([]Vec3, 0, len(tanks))
+	for _, t := range tanks {
+		start = append(start, t.Position)
+	}
+	g.touched, g.touching = g.touching, make(map[obstacleContact]bool)
+
+	// Update player, unless a controller drives their tank
+	if g.Player.Controller == nil {
+		g.Player.Update(g.Terrain.Size)
+		g.applyInput(g.Player, in)
+		g.climb(g.Player, start[0])
+		g.Player.Velocity = g.Player.Position.Sub(start[0]) // Obstacles are rammed at this tick's speed
+		g.collideWithTerrain(g.Player)
+
+		// Update aiming system
+		g.Player.AimingCircle.Update()
+	}
+
+	// Update AI and remote tanks on both teams
+	for i, t := range tanks {
+		if t.Health > 0 && t.Controller != nil {
+			g.applyInput(t, t.Controller.Control(g, t))
+			g.climb(t, start[i])
+			t.Velocity = t.Position.Sub(start[i])
+			g.collideWithTerrain(t)
+			t.AimingCircle.Update()
+			t.Update(g.Terrain.Size)
+		}
+	}
+
+	// Resolve tanks driving into each other
+	for i, t := range tanks {
+		t.Velocity = t.Position.Sub(start[i])
+	}
+	g.collideTanks()
+	for _, t := range tanks {
+		g.settle(t)
+	}
+	g.updateSpotting()
+	g.recordPoses(tanks)
+
+	// Update bullets
+	for i := len(g.Bullets) - 1; i >= 0; i-- {
+		bullet := g.Bullets[i]
+		previous := bullet.Position
+		bullet.Update()
+
+		// Sweep the whole step so fast shells cannot tunnel through cover
+		impact, struck, hitTerrain := g.Terrain.segmentHit(previous, bullet.Position)
+		if hit, ok := g.shellHit(bullet, previous, bullet.Position); ok {
+			point := previous.Add(bullet.Position.Sub(previous).Scale(hit.fraction))
+			if !hitTerrain || distanceSquared(previous, point) < distanceSquared(previous, impact) {
+				g.resolveHit(bullet, hit, point)
+				g.Bullets = append(g.Bullets[:i], g.Bullets[i+1:]...)
+				continue
+			}
+		}
+		if hitTerrain {
+			g.emit(Event{Kind: EventImpact, Position: impact})
+			if struck >= 0 {
+				g.damageObstacle(struck, bullet.Damage, direction2D(previous, bullet.Position))
+			}
+			g.Bullets = append(g.Bullets[:i], g.Bullets[i+1:]...)
+			continue
+		}
+
+		// Remove bullets that are out of bounds or expired
+		if !g.Terrain.Contains(bullet.Position) ||
+			bullet.LifeTime <= 0 {
+			g.Bullets = append(g.Bullets[:i], g.Bullets[i+1:]...)
+		}
+	}
+
+	g.updateZones()
+	g.updateMatch()
+}
+
+// Predict moves one tank by a tick of input the way the next Step would,
+// on its own: it doesn't fire, ram or collide with other tanks, and the
+// rest of the match, clock included, stands still. Network clients use it
+// to run the player's tank ahead of the server.
+func (g *Game) Predict(t *Tank, in Input) {
+	// Tanks hold still until the countdown ends
+	if g.Over() || g.Clock.Tick+1 < g.Match.StartTick || t.Health <= 0 {
+		return
+	}
+
+	start := t.Position
+	in.Fire = false
+	g.applyInput(t, in)
+	g.climb(t, start)
+	g.pushOut(t, nil)
+	t.AimingCircle.Update()
+	t.Update(g.Terrain.Size)
+	g.settle(t)
+}
+
+// Tanks returns the player, their allies and every enemy, alive or not.
+func (g *Game) Tanks() []*Tank {
+	tanks := make([]*Tank, 0, 1+len(g.Allies)+len(g.Enemies))
+	tanks = append(tanks, g.Player)
+	tanks = append(tanks, g.Allies...)
+	return append(tanks, g.Enemies...)
+}
+
+// AliveEnemies returns the number of enemy tanks that are still alive.
+func (g *Game) AliveEnemies() int {
+	return g.Alive(EnemyTeam)
+}
+
+// applyInput carries out one tick of a tank's input, whether it came from
+// the player or from the tank's controller.
+func (g *Game) applyInput(t *Tank, in Input) {
+	if t.Health <= 0 {
+		return
+	}
+
+	// Tank movement
+	if in.Forward {
+		t.MoveForward()
+		t.AimingCircle.IsAiming = false // Движение ухудшает точность
+	}
+	if in.Backward {
+		t.MoveBackward()
+		t.AimingCircle.IsAiming = false
+	}
+	if in.TurnLeft {
+		t.TurnLeft()
+		t.AimingCircle.IsAiming = false
+	}
+	if in.TurnRight {
+		t.TurnRight()
+		t.AimingCircle.IsAiming = false
+	}
+
+	// Turret rotation
+	if in.AimTurret {
+		t.TraverseTurretTowards(in.TurretAngle)
+	} else {
+		if in.TurretLeft {
+			t.TurretLeft()
+			t.AimingCircle.IsAiming = false
+		}
+		if in.TurretRight {
+			t.TurretRight()
+			t.AimingCircle.IsAiming = false
+		}
+	}
+
+	// Gun elevation
+	switch {
+	case in.HasAimPoint:
+		t.AimAt(in.AimPoint)
+	case in.GunUp:
+		t.ElevateTowards(t.MaxElevation)
+	case in.GunDown:
+		t.ElevateTowards(-t.MaxDepression)
+	}
+
+	// Shooting
+	if in.Fire {
+		if bullet := t.ShootWithAccuracy(t.AimingCircle.CurrentRadius, g.Clock.Tick, g.rng); bullet != nil {
+			bullet.Rewind = min(t.Latency, g.maxRewind)
+			g.Bullets = append(g.Bullets, bullet)
+			t.AimingCircle.IsAiming = false // После выстрела точность сбрасывается
+		}
+	}
+
+	// Right mouse button for aiming
+	if in.Aiming {
+		t.AimingCircle.IsAiming = true
+	} else {
+		t.AimingCircle.IsAiming = false
+	}
+}
+
+// Update shrinks or expands the circle by one tick.
+func (c *AimingCircle) Update() {
+	if c.IsAiming {
+		// Сведение - уменьшаем круг точности
+		c.CurrentRadius -= c.ShrinkSpeed
+		if c.CurrentRadius < c.MinRadius {
+			c.CurrentRadius = c.MinRadius
+		}
+	} else {
+		// Разведение - увеличиваем круг точности
+		c.CurrentRadius += c.ExpandSpeed
+		if c.CurrentRadius > c.MaxRadius {
+			c.CurrentRadius = c.MaxRadius
+		}
+	}
+}
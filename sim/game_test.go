@@ -0,0 +1,112 @@
+package sim
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// testConfig is a match short enough to play out in a test.
+func testConfig(seed int64, mode string) Config {
+	return Config{
+		Seed:      seed,
+		Mode:      mode,
+		RamDamage: DefaultRamDamage,
+		Countdown: DefaultCountdown,
+		TimeLimit: 3 * time.Minute,
+	}
+}
+
+// playOut steps a match with every tank under AI control until it ends.
+func playOut(t *testing.T, cfg Config) *Game {
+	t.Helper()
+	cfg.PlayerAI = true
+	g := NewGame(cfg)
+	limit := Ticks(cfg.Countdown+cfg.TimeLimit) + 1
+	for !g.Over() {
+		if g.Clock.Tick > limit {
+			t.Fatalf("seed %d: match still going at tick %d", cfg.Seed, g.Clock.Tick)
+		}
+		g.Step(Input{})
+	}
+	return g
+}
+
+func TestMatchOutcome(t *testing.T) {
+	tests := []struct {
+		mode   string
+		seed   int64
+		winner Team
+		end    MatchEnd
+	}{
+		{"skirmish", 1, EnemyTeam, EndDestroyed},
+		{"7v7", 1, PlayerTeam, EndDestroyed},
+	}
+	for _, test := range tests {
+		g := playOut(t, testConfig(test.seed, test.mode))
+		winner, ok := g.Winner()
+		if !ok || winner != test.winner || g.Match.End != test.end {
+			t.Errorf("%s seed %d: %v (%v), want %v (%v)",
+				test.mode, test.seed, winner, g.Match.End, test.winner, test.end)
+		}
+		// The same seed plays out the same way, to the tick
+		if again := playOut(t, testConfig(test.seed, test.mode)); !reflect.DeepEqual(stateOf(again), stateOf(g)) {
+			t.Errorf("%s seed %d: ended at tick %d, then at tick %d",
+				test.mode, test.seed, g.Clock.Tick, again.Clock.Tick)
+		}
+	}
+}
+
+// matchState is what two runs of the same match must agree on.
+type matchState struct {
+	Tick    int
+	Match   Match
+	Tanks   []Tank
+	Bullets []Bullet
+	Zones   []CaptureZone
+}
+
+func stateOf(g *Game) matchState {
+	s := matchState{Tick: g.Clock.Tick, Match: g.Match}
+	for _, t := range g.Tanks() {
+		tank := *t
+		tank.Controller = nil // Holds pointers that differ between runs
+		s.Tanks = append(s.Tanks, tank)
+	}
+	for _, b := range g.Bullets {
+		bullet := *b
+		bullet.Shooter = nil
+		s.Bullets = append(s.Bullets, bullet)
+	}
+	for _, z := range g.Zones {
+		s.Zones = append(s.Zones, *z)
+	}
+	return s
+}
+
+func TestSameSeedSameMatch(t *testing.T) {
+	for _, mode := range []string{"skirmish", "7v7"} {
+		a := playOut(t, testConfig(42, mode))
+		b := playOut(t, testConfig(42, mode))
+		if !reflect.DeepEqual(stateOf(a), stateOf(b)) {
+			t.Errorf("%s: two runs of seed 42 ended differently", mode)
+		}
+	}
+}
+
+// TestManyMatches plays a spread of seeds to the end, as CI does to catch
+// matches that hang or crash.
+func TestManyMatches(t *testing.T) {
+	seeds := 100
+	if testing.Short() {
+		seeds = 10
+	}
+	wins := map[Team]int{}
+	for seed := int64(1); seed <= int64(seeds); seed++ {
+		g := playOut(t, testConfig(seed, "skirmish"))
+		if winner, ok := g.Winner(); ok {
+			wins[winner]++
+		}
+	}
+	t.Logf("%d matches: %d won by the player team, %d by the enemy", seeds, wins[PlayerTeam], wins[EnemyTeam])
+}
@@ -0,0 +1,110 @@
+package sim
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/png"
+	"math"
+	"math/rand"
+	"os"
+)
+
+const (
+	// HeightmapSize is the number of samples along each side of a generated
+	// heightmap.
+	HeightmapSize = 129
+	// HillHeight is the height of a full-white heightmap sample.
+	HillHeight = 8
+)
+
+// Heightmap is the ground's elevation as a square grid of 8-bit samples
+// stretched over the whole map, laid out like a grayscale image with rows
+// running along +Z. Sample (0, 0) is the map's (-X, -Z) corner.
+type Heightmap struct {
+	Size    int     // Samples along each side
+	Height  float32 // Height of a full-white sample above GroundLevel
+	Samples []byte  // Row-major, Size*Size
+}
+
+// NewHeightmap raises rolling hills from rng, so the same seed always
+// produces the same landscape.
+func NewHeightmap(rng *rand.Rand) *Heightmap {
+	const size = HeightmapSize
+	field := make([]float64, size*size)
+
+	for hill := 0; hill < 14; hill++ {
+		centerX := float64(rng.Intn(size))
+		centerZ := float64(rng.Intn(size))
+		radius := 5 + rng.Float64()*12 // In samples
+		height := 0.25 + rng.Float64()*0.6
+
+		for z := 0; z < size; z++ {
+			for x := 0; x < size; x++ {
+				d2 := (float64(x)-centerX)*(float64(x)-centerX) + (float64(z)-centerZ)*(float64(z)-centerZ)
+				field[z*size+x] += height * math.Exp(-d2/(2*radius*radius))
+			}
+		}
+	}
+
+	h := &Heightmap{Size: size, Height: HillHeight, Samples: make([]byte, size*size)}
+	for i, v := range field {
+		h.Samples[i] = byte(math.Min(v, 1) * 255)
+	}
+	return h
+}
+
+// LoadHeightmap reads a square grayscale image (PNG) as a heightmap; white
+// is height above the lowest ground.
+func LoadHeightmap(path string, height float32) (*Heightmap, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("heightmap %s: %w", path, err)
+	}
+	bounds := img.Bounds()
+	if bounds.Dx() != bounds.Dy() || bounds.Dx() < 2 {
+		return nil, fmt.Errorf("heightmap %s: image must be square, got %dx%d", path, bounds.Dx(), bounds.Dy())
+	}
+
+	h := &Heightmap{Size: bounds.Dx(), Height: height, Samples: make([]byte, bounds.Dx()*bounds.Dy())}
+	for z := 0; z < h.Size; z++ {
+		for x := 0; x < h.Size; x++ {
+			gray := color.GrayModel.Convert(img.At(bounds.Min.X+x, bounds.Min.Y+z)).(color.Gray)
+			h.Samples[z*h.Size+x] = gray.Y
+		}
+	}
+	return h, nil
+}
+
+// HeightAt returns the height above GroundLevel at a point on the sample
+// grid, where (Size-1, Size-1) is the far corner. Each grid square is split
+// into two triangles the same way the renderer's mesh is, so tanks sit
+// exactly on the ground that is drawn.
+func (h *Heightmap) HeightAt(gx, gz float32) float32 {
+	gx = clamp(gx, 0, float32(h.Size-1))
+	gz = clamp(gz, 0, float32(h.Size-1))
+
+	ix := int(math.Min(float64(gx), float64(h.Size-2)))
+	iz := int(math.Min(float64(gz), float64(h.Size-2)))
+	fx, fz := gx-float32(ix), gz-float32(iz)
+
+	h00 := h.sample(ix, iz)
+	h10 := h.sample(ix+1, iz)
+	h01 := h.sample(ix, iz+1)
+	h11 := h.sample(ix+1, iz+1)
+
+	if fx+fz <= 1 {
+		return h00 + fx*(h10-h00) + fz*(h01-h00)
+	}
+	return h11 + (1-fx)*(h01-h11) + (1-fz)*(h10-h11)
+}
+
+func (h *Heightmap) sample(x, z int) float32 {
+	return float32(h.Samples[z*h.Size+x]) / 255 * h.Height
+}
@@ -0,0 +1,438 @@
+package sim
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+// MapVersion is the map file format this build reads and writes.
+const MapVersion = 1
+
+// Map is a hand-authored battlefield: the ground, what stands on it, where
+// each team starts and the bases they fight over. It is kept whole in the
+// match Config so replays don't depend on the map file.
+type Map struct {
+	Name      string
+	Size      float32    // Half the width, like Terrain.Size
+	Ground    *Heightmap // Flat when the file names no heightmap
+	Obstacles []Obstacle
+
+	// HeightmapPath is the image Ground was loaded from, relative to the
+	// working directory; empty for flat ground.
+	HeightmapPath string
+
+	Spawns map[Team][]Vec3
+	Zones  []CaptureZone
+
+	Environment Environment
+}
+
+// Environment is a map's weather and palette.
+type Environment struct {
+	Sky     Color
+	Lowland Color // Ground color at the lowest point
+	Hilltop Color // Ground color at the highest point
+
+	// Visibility scales every tank's view range: 1 is a clear day, lower
+	// is haze or fog.
+	Visibility float32
+}
+
+// Color is an RGB color.
+type Color [3]uint8
+
+// DefaultEnvironment is the clear summer day of generated maps.
+func DefaultEnvironment() Environment {
+	return Environment{
+		Sky:        Color{102, 191, 255},
+		Lowland:    Color{60, 140, 50},
+		Hilltop:    Color{140, 130, 70},
+		Visibility: 1,
+	}
+}
+
+// mapFile is the JSON layout of a map. Positions are [x, z] on the ground
+// plane and angles are in degrees; the heightmap path is relative to the
+// map file.
+type mapFile struct {
+	Version    int     `json:"version"`
+	Name       string  `json:"name"`
+	Size       float32 `json:"size"` // Width of the whole map
+	Heightmap  string  `json:"heightmap,omitempty"`
+	HillHeight float32 `json:"hill_height,omitempty"` // Height of a white heightmap pixel
+
+	Environment *mapEnvironment `json:"environment,omitempty"`
+
+	Spawns    map[string][][2]float32 `json:"spawns"` // Keyed by team
+	Zones     []mapZone               `json:"zones"`
+	Obstacles []mapObstacle           `json:"obstacles"`
+}
+
+type mapObstacle struct {
+	Type     string     `json:"type"`
+	Position [2]float32 `json:"position"`
+	Size     [3]float32 `json:"size"` // Width, height, length
+	Rotation float32    `json:"rotation"`
+}
+
+type mapZone struct {
+	Team     string     `json:"team"`
+	Position [2]float32 `json:"position"`
+	Radius   float32    `json:"radius"`
+}
+
+// mapEnvironment leaves out whatever keeps its default.
+type mapEnvironment struct {
+	Sky        *Color   `json:"sky,omitempty"`
+	Lowland    *Color   `json:"lowland,omitempty"`
+	Hilltop    *Color   `json:"hilltop,omitempty"`
+	Visibility *float32 `json:"visibility,omitempty"`
+}
+
+// NewMap starts an empty map of the generated maps' size, with a spawn
+// point and a base at each end. ground may be nil for flat ground.
+func NewMap(name string, ground *Heightmap) *Map {
+	if ground == nil {
+		ground = flatGround()
+	}
+	m := &Map{
+		Name:   name,
+		Size:   MapSize,
+		Ground: ground,
+		Spawns: map[Team][]Vec3{
+			PlayerTeam: {NewVec3(0, 0, -(MapSize - 12))},
+			EnemyTeam:  {NewVec3(0, 0, MapSize-12)},
+		},
+		Environment: DefaultEnvironment(),
+	}
+	for _, base := range teamBases() {
+		m.Zones = append(m.Zones, *base)
+	}
+	return m
+}
+
+// flatGround is a heightmap with nothing on it.
+func flatGround() *Heightmap {
+	return &Heightmap{Size: 2, Samples: make([]byte, 4)}
+}
+
+// LoadMap reads and validates a map file.
+func LoadMap(path string) (*Map, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file mapFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	m, err := file.build(filepath.Dir(path))
+	if err == nil {
+		err = m.validate()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return m, nil
+}
+
+// SaveMap validates m and writes it as a map file. The heightmap is
+// referenced relative to the new file, not copied.
+func SaveMap(path string, m *Map) error {
+	if err := m.validate(); err != nil {
+		return err
+	}
+
+	file := mapFile{
+		Version:   MapVersion,
+		Name:      m.Name,
+		Size:      round2(m.Size * 2),
+		Spawns:    make(map[string][][2]float32),
+		Zones:     make([]mapZone, 0, len(m.Zones)),
+		Obstacles: make([]mapObstacle, 0, len(m.Obstacles)),
+	}
+	if m.HeightmapPath != "" {
+		file.Heightmap = relativePath(filepath.Dir(path), m.HeightmapPath)
+		file.HillHeight = m.Ground.Height
+	}
+
+	env, defaults := m.Environment, DefaultEnvironment()
+	file.Environment = &mapEnvironment{}
+	if env.Sky != defaults.Sky {
+		file.Environment.Sky = &env.Sky
+	}
+	if env.Lowland != defaults.Lowland {
+		file.Environment.Lowland = &env.Lowland
+	}
+	if env.Hilltop != defaults.Hilltop {
+		file.Environment.Hilltop = &env.Hilltop
+	}
+	if env.Visibility != defaults.Visibility {
+		file.Environment.Visibility = &env.Visibility
+	}
+	if *file.Environment == (mapEnvironment{}) {
+		file.Environment = nil
+	}
+
+	for team, points := range m.Spawns {
+		for _, p := range points {
+			file.Spawns[team.String()] = append(file.Spawns[team.String()], groundPoint(p))
+		}
+	}
+	for _, z := range m.Zones {
+		file.Zones = append(file.Zones, mapZone{
+			Team:     z.Team.String(),
+			Position: groundPoint(z.Center),
+			Radius:   round2(z.Radius),
+		})
+	}
+	for _, o := range m.Obstacles {
+		file.Obstacles = append(file.Obstacles, mapObstacle{
+			Type:     o.Type,
+			Position: groundPoint(o.Position),
+			Size:     [3]float32{round2(o.Size.X), round2(o.Size.Y), round2(o.Size.Z)},
+			Rotation: round2(o.Rotation * 180 / math.Pi),
+		})
+	}
+
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+	// Keep coordinates and colors on one line each
+	data = numberList.ReplaceAllFunc(data, func(list []byte) []byte {
+		return bytes.ReplaceAll(whitespace.ReplaceAll(list, nil), []byte(","), []byte(", "))
+	})
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+var (
+	numberList = regexp.MustCompile(`\[[-0-9.,\s]+\]`)
+	whitespace = regexp.MustCompile(`\s+`)
+)
+
+// groundPoint drops a position's height and rounds it for the file.
+func groundPoint(p Vec3) [2]float32 {
+	return [2]float32{round2(p.X), round2(p.Z)}
+}
+
+// round2 rounds to two decimals, so saved maps diff cleanly.
+func round2(v float32) float32 {
+	return float32(math.Round(float64(v)*100) / 100)
+}
+
+// relativePath returns target relative to dir where possible.
+func relativePath(dir, target string) string {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return target
+	}
+	absTarget, err := filepath.Abs(target)
+	if err != nil {
+		return target
+	}
+	if rel, err := filepath.Rel(absDir, absTarget); err == nil {
+		return filepath.ToSlash(rel)
+	}
+	return absTarget
+}
+
+// build converts the file's contents; dir is where relative paths start.
+func (f *mapFile) build(dir string) (*Map, error) {
+	if f.Version != MapVersion {
+		return nil, fmt.Errorf("unsupported map version %d (want %d)", f.Version, MapVersion)
+	}
+
+	m := &Map{
+		Name:        f.Name,
+		Size:        f.Size / 2,
+		Ground:      flatGround(),
+		Spawns:      make(map[Team][]Vec3),
+		Environment: DefaultEnvironment(),
+	}
+
+	if f.Heightmap != "" {
+		height := f.HillHeight
+		if height == 0 {
+			height = HillHeight
+		}
+		path := filepath.FromSlash(f.Heightmap)
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		ground, err := LoadHeightmap(path, height)
+		if err != nil {
+			return nil, err
+		}
+		m.Ground, m.HeightmapPath = ground, path
+	}
+
+	for _, o := range f.Obstacles {
+		m.Obstacles = append(m.Obstacles, Obstacle{
+			Position: NewVec3(o.Position[0], 0, o.Position[1]),
+			Size:     NewVec3(o.Size[0], o.Size[1], o.Size[2]),
+			Rotation: o.Rotation * math.Pi / 180,
+			Type:     o.Type,
+		})
+	}
+
+	for name, points := range f.Spawns {
+		team, ok := parseTeam(name)
+		if !ok {
+			return nil, fmt.Errorf("spawns: unknown team %q", name)
+		}
+		for _, p := range points {
+			m.Spawns[team] = append(m.Spawns[team], NewVec3(p[0], 0, p[1]))
+		}
+	}
+
+	for i, z := range f.Zones {
+		team, ok := parseTeam(z.Team)
+		if !ok {
+			return nil, fmt.Errorf("zone %d: unknown team %q", i, z.Team)
+		}
+		m.Zones = append(m.Zones, CaptureZone{
+			Team:   team,
+			Center: NewVec3(z.Position[0], 0, z.Position[1]),
+			Radius: z.Radius,
+		})
+	}
+
+	if env := f.Environment; env != nil {
+		if env.Sky != nil {
+			m.Environment.Sky = *env.Sky
+		}
+		if env.Lowland != nil {
+			m.Environment.Lowland = *env.Lowland
+		}
+		if env.Hilltop != nil {
+			m.Environment.Hilltop = *env.Hilltop
+		}
+		if env.Visibility != nil {
+			m.Environment.Visibility = *env.Visibility
+		}
+	}
+
+	return m, nil
+}
+
+// validate checks that a match can be fought on the map.
+func (m *Map) validate() error {
+	if m.Size < 10 {
+		return fmt.Errorf("size must be at least 20, got %v", m.Size*2)
+	}
+	if m.Size > MaxMapSize {
+		return fmt.Errorf("size must be at most %v, got %v", MaxMapSize*2, m.Size*2)
+	}
+	inside := func(p Vec3) bool {
+		return p.X >= -m.Size && p.X <= m.Size && p.Z >= -m.Size && p.Z <= m.Size
+	}
+
+	for i, o := range m.Obstacles {
+		if _, ok := ObstacleTypes[o.Type]; !ok {
+			return fmt.Errorf("obstacle %d: unknown type %q", i, o.Type)
+		}
+		if o.Size.X <= 0 || o.Size.Y <= 0 || o.Size.Z <= 0 {
+			return fmt.Errorf("obstacle %d: size must be positive, got %v", i, o.Size)
+		}
+		if !inside(o.Position) {
+			return fmt.Errorf("obstacle %d: position %v is off the map", i, groundPoint(o.Position))
+		}
+	}
+
+	for _, team := range []Team{PlayerTeam, EnemyTeam} {
+		if len(m.Spawns[team]) == 0 {
+			return fmt.Errorf("spawns: team %s has no spawn points", team)
+		}
+		for _, p := range m.Spawns[team] {
+			if !inside(p) {
+				return fmt.Errorf("spawns: %s point %v is off the map", team, groundPoint(p))
+			}
+		}
+	}
+
+	for i, z := range m.Zones {
+		if z.Radius <= 0 {
+			return fmt.Errorf("zone %d: radius must be positive, got %v", i, z.Radius)
+		}
+		if !inside(z.Center) {
+			return fmt.Errorf("zone %d: position %v is off the map", i, groundPoint(z.Center))
+		}
+	}
+
+	if v := m.Environment.Visibility; v <= 0 || v > 1 {
+		return fmt.Errorf("environment: visibility must be in (0, 1], got %v", v)
+	}
+	return nil
+}
+
+// parseTeam is the inverse of Team.String.
+func parseTeam(name string) (Team, bool) {
+	for _, team := range []Team{PlayerTeam, EnemyTeam} {
+		if team.String() == name {
+			return team, true
+		}
+	}
+	return 0, false
+}
+
+// Terrain builds the battlefield the map describes.
+func (m *Map) Terrain() *Terrain {
+	t := &Terrain{
+		Size:      m.Size,
+		Obstacles: append([]Obstacle(nil), m.Obstacles...),
+		Ground:    m.Ground,
+	}
+	t.prepareObstacles()
+	return t
+}
+
+// zones returns fresh copies of the map's bases.
+func (m *Map) zones() []*CaptureZone {
+	zones := make([]*CaptureZone, 0, len(m.Zones))
+	for _, z := range m.Zones {
+		zone := z
+		zones = append(zones, &zone)
+	}
+	return zones
+}
+
+// spawns places n tanks of a team on its spawn points. When there are more
+// tanks than points, the extras line up beside them.
+func (m *Map) spawns(team Team, n int) []Vec3 {
+	const spacing = 8
+
+	points := m.Spawns[team]
+	spawns := make([]Vec3, 0, n)
+	for i := 0; i < n; i++ {
+		p := points[i%len(points)]
+		if rank := i / len(points); rank > 0 {
+			// Alternate right and left of the point, further each time
+			offset := float32((rank+1)/2) * spacing
+			if rank%2 == 0 {
+				offset = -offset
+			}
+			p.X = clamp(p.X+offset, -m.Size+5, m.Size-5)
+		}
+		spawns = append(spawns, p)
+	}
+	return spawns
+}
+
+// objective returns where a team advances to: the enemy's base, or the
+// enemy's first spawn point when the map has no base for them.
+func (m *Map) objective(team Team) Vec3 {
+	enemy := team.Opponent()
+	for _, z := range m.Zones {
+		if z.Team == enemy {
+			return z.Center
+		}
+	}
+	return m.Spawns[enemy][0]
+}
@@ -0,0 +1,41 @@
+package sim
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadMapSize(t *testing.T) {
+	tests := []struct {
+		size float32
+		want string // Error, empty to load
+	}{
+		{18, "at least 20"},
+		{20, ""},
+		{200, ""},
+		{MaxMapSize * 2, ""},
+		{MaxMapSize*2 + 2, "at most"},
+		{1e9, "at most"},
+	}
+	dir := t.TempDir()
+	for _, tt := range tests {
+		path := filepath.Join(dir, fmt.Sprintf("size%v.json", tt.size))
+		file := fmt.Sprintf(`{"version": 1, "size": %v, "spawns": {"player": [[0, -5]], "enemy": [[0, 5]]}}`, tt.size)
+		if err := os.WriteFile(path, []byte(file), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		m, err := LoadMap(path)
+		switch {
+		case tt.want == "" && err != nil:
+			t.Errorf("size %v: %v", tt.size, err)
+		case tt.want == "" && m.Size*2 != tt.size:
+			t.Errorf("size %v: loaded as %v", tt.size, m.Size*2)
+		case tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)):
+			t.Errorf("size %v: got %v, want %q", tt.size, err, tt.want)
+		}
+	}
+}
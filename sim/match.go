@@ -0,0 +1,209 @@
+package sim
+
+import (
+	"math"
+	"time"
+)
+
+// MatchPhase is the stage a match is in. The outcomes are from the point of
+// view of the player's team.
+type MatchPhase int
+
+const (
+	MatchCountdown  MatchPhase = iota // Tanks hold position until the start
+	MatchInProgress                   // Battle under way
+	MatchVictory                      // The player's team won
+	MatchDefeat                       // The enemy team won
+	MatchDraw                         // Time ran out, or both teams fell together
+)
+
+func (p MatchPhase) String() string {
+	switch p {
+	case MatchCountdown:
+		return "countdown"
+	case MatchInProgress:
+		return "in progress"
+	case MatchVictory:
+		return "victory"
+	case MatchDefeat:
+		return "defeat"
+	case MatchDraw:
+		return "draw"
+	}
+	return "unknown"
+}
+
+// MatchEnd is why a match finished.
+type MatchEnd int
+
+const (
+	EndNone      MatchEnd = iota
+	EndDestroyed          // A team lost all its tanks
+	EndCaptured           // A team's base was captured
+	EndTimeLimit          // The time limit ran out
+)
+
+func (e MatchEnd) String() string {
+	switch e {
+	case EndDestroyed:
+		return "all enemy tanks destroyed"
+	case EndCaptured:
+		return "base captured"
+	case EndTimeLimit:
+		return "time limit reached"
+	}
+	return ""
+}
+
+// Match tracks the lifecycle of a battle from countdown to result.
+type Match struct {
+	Phase     MatchPhase
+	End       MatchEnd
+	Winner    Team // Only meaningful on victory or defeat
+	StartTick int  // Tick the countdown ends and the battle begins
+	EndTick   int  // Tick the battle stops at; 0 means no time limit
+}
+
+// Over reports whether the match has finished.
+func (g *Game) Over() bool {
+	return g.Match.Phase >= MatchVictory
+}
+
+// Winner returns the winning team once the match is over. It reports false
+// while the battle goes on and on a draw.
+func (g *Game) Winner() (Team, bool) {
+	if g.Match.Phase != MatchVictory && g.Match.Phase != MatchDefeat {
+		return 0, false
+	}
+	return g.Match.Winner, true
+}
+
+// TimeLeft returns the ticks until the countdown ends or, once the battle is
+// under way, until the time limit. It is 0 without a time limit.
+func (g *Game) TimeLeft() int {
+	switch {
+	case g.Match.Phase == MatchCountdown:
+		return g.Match.StartTick - g.Clock.Tick
+	case g.Match.EndTick == 0 || g.Over():
+		return 0
+	}
+	return g.Match.EndTick - g.Clock.Tick
+}
+
+// newMatch schedules the countdown and time limit from the config.
+func newMatch(cfg Config) Match {
+	m := Match{StartTick: Ticks(cfg.Countdown)}
+	if m.StartTick == 0 {
+		m.Phase = MatchInProgress
+	}
+	if cfg.TimeLimit > 0 {
+		m.EndTick = m.StartTick + Ticks(cfg.TimeLimit)
+	}
+	return m
+}
+
+// updateMatch ends the battle once a team is destroyed, a base falls or time
+// runs out.
+func (g *Game) updateMatch() {
+	now := g.Clock.Tick
+	if g.Match.Phase == MatchCountdown && now >= g.Match.StartTick {
+		g.Match.Phase = MatchInProgress
+	}
+	if g.Match.Phase != MatchInProgress {
+		return
+	}
+
+	player, enemy := g.Alive(PlayerTeam), g.Alive(EnemyTeam)
+	switch {
+	case player == 0 && enemy == 0:
+		g.endMatch(MatchDraw, EndDestroyed, 0)
+	case enemy == 0:
+		g.endMatch(MatchVictory, EndDestroyed, PlayerTeam)
+	case player == 0:
+		g.endMatch(MatchDefeat, EndDestroyed, EnemyTeam)
+	}
+	if g.Over() {
+		return
+	}
+
+	for _, zone := range g.Zones {
+		if zone.Progress >= 1 {
+			if zone.Team == PlayerTeam {
+				g.endMatch(MatchDefeat, EndCaptured, EnemyTeam)
+			} else {
+				g.endMatch(MatchVictory, EndCaptured, PlayerTeam)
+			}
+			return
+		}
+	}
+
+	if g.Match.EndTick > 0 && now >= g.Match.EndTick {
+		g.endMatch(MatchDraw, EndTimeLimit, 0)
+	}
+}
+
+func (g *Game) endMatch(phase MatchPhase, end MatchEnd, winner Team) {
+	g.Match.Phase = phase
+	g.Match.End = end
+	g.Match.Winner = winner
+	g.Match.EndTick = g.Clock.Tick
+}
+
+const (
+	// CaptureTime is how long one tank takes to capture a base alone. Up to
+	// MaxCapturers tanks speed it up together.
+	CaptureTime  = 60 * time.Second
+	MaxCapturers = 3
+
+	// CaptureRadius is the size of a team's base.
+	CaptureRadius = 12
+)
+
+// CaptureZone is a team's base. Enemy tanks standing inside capture it; the
+// team loses when Progress reaches 1.
+type CaptureZone struct {
+	Team     Team // Team the base belongs to
+	Center   Vec3
+	Radius   float32
+	Progress float32 // 0 to 1
+}
+
+// Contains reports whether a ground point lies inside the zone.
+func (z *CaptureZone) Contains(point Vec3) bool {
+	return distance2D(z.Center, point) <= z.Radius
+}
+
+// teamBases places a base for each team at its end of the map.
+func teamBases() []*CaptureZone {
+	return []*CaptureZone{
+		{Team: PlayerTeam, Center: NewVec3(0, 0, -(MapSize - 20)), Radius: CaptureRadius},
+		{Team: EnemyTeam, Center: NewVec3(0, 0, MapSize-20), Radius: CaptureRadius},
+	}
+}
+
+// updateZones advances capture progress by the number of enemy tanks inside
+// each base. Progress resets when the base is left empty or any capturing
+// tank takes damage.
+func (g *Game) updateZones() {
+	for _, zone := range g.Zones {
+		capturers, reset := 0, false
+		for _, t := range g.Tanks() {
+			if t.Health <= 0 || t.Team == zone.Team || !zone.Contains(t.Position) {
+				continue
+			}
+			capturers++
+			reset = reset || g.damaged[t]
+		}
+
+		switch {
+		case capturers == 0 || reset:
+			if zone.Progress > 0 && reset {
+				g.emit(Event{Kind: EventCaptureReset, Position: zone.Center})
+			}
+			zone.Progress = 0
+		default:
+			rate := float32(math.Min(float64(capturers), MaxCapturers)) / float32(Ticks(CaptureTime))
+			zone.Progress = clamp(zone.Progress+rate, 0, 1)
+		}
+	}
+}
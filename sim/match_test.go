@@ -0,0 +1,56 @@
+package sim
+
+import "testing"
+
+// idle is a controller that leaves its tank where it is.
+type idle struct{}
+
+func (idle) Control(*Game, *Tank) Input { return Input{} }
+
+// TestCaptureResetByRam has an enemy tank capture the player's base until
+// the player rams it, in a match whose events are never drained.
+func TestCaptureResetByRam(t *testing.T) {
+	cfg := testConfig(1, "skirmish")
+	cfg.Countdown = 0
+	g := NewGame(cfg)
+	g.Terrain.Obstacles = nil
+	for _, e := range g.Enemies {
+		e.Controller = idle{}
+	}
+
+	var base *CaptureZone
+	for _, z := range g.Zones {
+		if z.Team == PlayerTeam {
+			base = z
+		}
+	}
+	place := func(tank *Tank, x, z, rotation float32) {
+		tank.Position = NewVec3(x, g.Terrain.HeightAt(x, z), z)
+		tank.Rotation = rotation
+	}
+	capturer := g.Enemies[0]
+	place(capturer, base.Center.X, base.Center.Z, 0)
+	place(g.Player, base.Center.X, base.Center.Z-12, 0) // Facing the capturer
+
+	var progress float32
+	for tick := 0; tick < 3*TickRate; tick++ {
+		g.Step(Input{Forward: true})
+		if base.Progress > 0 {
+			progress = base.Progress
+			continue
+		}
+		if progress == 0 {
+			t.Fatal("base capture never started")
+		}
+		if capturer.Health == capturer.MaxHealth {
+			t.Fatal("capture reset without the capturer taking damage")
+		}
+		for _, e := range g.DrainEvents() {
+			if e.Kind == EventCaptureReset && e.Tick == g.Clock.Tick {
+				return
+			}
+		}
+		t.Fatal("capture reset without an event")
+	}
+	t.Fatalf("capture at %v never reset", base.Progress)
+}
@@ -0,0 +1,270 @@
+package sim
+
+import (
+	"container/heap"
+	"math"
+)
+
+const (
+	// NavCellSize is the edge length of a navigation grid cell in world units.
+	NavCellSize = 2
+	// NavClearance is how far paths keep a tank's center from obstacles,
+	// roughly half the width of the widest hull.
+	NavClearance = 2
+	// NavMaxSlope is the steepest ground, in degrees, that paths cross; the
+	// least agile classes can still climb it.
+	NavMaxSlope = 22
+)
+
+// NavGrid is a walkability grid over the map that AI tanks plan routes on.
+// A cell is blocked when its center comes within NavClearance of an
+// obstacle or the ground there is steeper than NavMaxSlope.
+type NavGrid struct {
+	CellSize float32
+	Width    int // Cells along X
+	Height   int // Cells along Z
+	OriginX  float32
+	OriginZ  float32
+
+	blocked []bool
+}
+
+// NewNavGrid rasterises the terrain's obstacles into a grid covering the map.
+func NewNavGrid(terrain *Terrain) *NavGrid {
+	cells := int(math.Ceil(float64(2 * terrain.Size / NavCellSize)))
+	n := &NavGrid{
+		CellSize: NavCellSize,
+		Width:    cells,
+		Height:   cells,
+		OriginX:  -terrain.Size,
+		OriginZ:  -terrain.Size,
+		blocked:  make([]bool, cells*cells),
+	}
+
+	n.rasterize(terrain, 0, 0, n.Width-1, n.Height-1)
+	return n
+}
+
+// Refresh rasterises the cells around area again, after the obstacles there
+// were destroyed or replaced.
+func (n *NavGrid) Refresh(terrain *Terrain, area Rect) {
+	reach := area.radius() + NavClearance*math.Sqrt2
+	minX, minZ := n.cell(NewVec3(area.CenterX-reach, 0, area.CenterZ-reach))
+	maxX, maxZ := n.cell(NewVec3(area.CenterX+reach, 0, area.CenterZ+reach))
+	n.rasterize(terrain, minX, minZ, maxX, maxZ)
+}
+
+// rasterize marks the cells from (minX, minZ) to (maxX, maxZ) blocked where
+// the ground is too steep or an obstacle, inflated by the clearance, stands.
+func (n *NavGrid) rasterize(terrain *Terrain, minX, minZ, maxX, maxZ int) {
+	maxSlope := radians(NavMaxSlope)
+	for z := minZ; z <= maxZ; z++ {
+		for x := minX; x <= maxX; x++ {
+			center := n.center(x, z)
+			n.blocked[z*n.Width+x] = terrain.Slope(center.X, center.Z) > maxSlope
+		}
+	}
+
+	for _, obstacle := range terrain.Obstacles {
+		footprint := obstacle.Footprint()
+		footprint.HalfWidth += NavClearance
+		footprint.HalfLength += NavClearance
+
+		// Only visit the cells under the footprint's bounding circle
+		reach := footprint.radius()
+		fromX, fromZ := n.cell(NewVec3(footprint.CenterX-reach, 0, footprint.CenterZ-reach))
+		toX, toZ := n.cell(NewVec3(footprint.CenterX+reach, 0, footprint.CenterZ+reach))
+		for z := max(fromZ, minZ); z <= min(toZ, maxZ); z++ {
+			for x := max(fromX, minX); x <= min(toX, maxX); x++ {
+				center := n.center(x, z)
+				if footprint.contains(center.X, center.Z) {
+					n.blocked[z*n.Width+x] = true
+				}
+			}
+		}
+	}
+}
+
+// Walkable reports whether a tank can stand at the given ground point.
+func (n *NavGrid) Walkable(point Vec3) bool {
+	x, z := n.cell(point)
+	return !n.blocked[z*n.Width+x]
+}
+
+// FindPath plans a route from one ground point to another with A* and
+// returns its waypoints, ending at to. When either end lies inside an
+// obstacle the nearest walkable cell stands in for it. It reports false when
+// no route exists.
+func (n *NavGrid) FindPath(from, to Vec3) ([]Vec3, bool) {
+	start, ok := n.nearestWalkable(n.index(from))
+	if !ok {
+		return nil, false
+	}
+	goal, ok := n.nearestWalkable(n.index(to))
+	if !ok {
+		return nil, false
+	}
+
+	cameFrom := make(map[int]int)
+	cost := map[int]float32{start: 0}
+	open := &navQueue{{cell: start, priority: n.heuristic(start, goal)}}
+
+	for open.Len() > 0 {
+		current := heap.Pop(open).(navNode).cell
+		if current == goal {
+			path := n.smooth(n.unwind(cameFrom, start, goal))
+			if len(path) > 1 {
+				path = path[1:] // The tank is already at the start
+			}
+			if goal == n.index(to) {
+				path[len(path)-1] = NewVec3(to.X, 0, to.Z)
+			}
+			return path, true
+		}
+
+		cx, cz := current%n.Width, current/n.Width
+		for _, step := range navSteps {
+			x, z := cx+step.dx, cz+step.dz
+			if !n.open(x, z) {
+				continue
+			}
+			// Diagonal moves must not cut the corner of a blocked cell
+			if step.dx != 0 && step.dz != 0 && (!n.open(cx+step.dx, cz) || !n.open(cx, cz+step.dz)) {
+				continue
+			}
+
+			next := z*n.Width + x
+			nextCost := cost[current] + step.cost
+			if known, seen := cost[next]; seen && known <= nextCost {
+				continue
+			}
+			cost[next] = nextCost
+			cameFrom[next] = current
+			heap.Push(open, navNode{cell: next, priority: nextCost + n.heuristic(next, goal)})
+		}
+	}
+
+	return nil, false
+}
+
+// unwind walks the A* parents back from goal and returns the cell centers
+// from start to goal.
+func (n *NavGrid) unwind(cameFrom map[int]int, start, goal int) []Vec3 {
+	cells := []int{goal}
+	for cell := goal; cell != start; cell = cameFrom[cell] {
+		cells = append(cells, cameFrom[cell])
+	}
+
+	path := make([]Vec3, 0, len(cells))
+	for i := len(cells) - 1; i >= 0; i-- {
+		path = append(path, n.center(cells[i]%n.Width, cells[i]/n.Width))
+	}
+	return path
+}
+
+// smooth drops waypoints that can be skipped in a straight line, so tanks
+// drive direct legs instead of a staircase of cell steps.
+func (n *NavGrid) smooth(path []Vec3) []Vec3 {
+	if len(path) < 3 {
+		return path
+	}
+
+	smoothed := []Vec3{path[0]}
+	anchor := path[0]
+	for i := 1; i < len(path)-1; i++ {
+		if !n.clearLine(anchor, path[i+1]) {
+			anchor = path[i]
+			smoothed = append(smoothed, anchor)
+		}
+	}
+	return append(smoothed, path[len(path)-1])
+}
+
+// clearLine reports whether every cell along the straight line between two
+// points is walkable, sampling at a quarter cell.
+func (n *NavGrid) clearLine(from, to Vec3) bool {
+	steps := int(distance2D(from, to)/(n.CellSize/4)) + 1
+	for i := 0; i <= steps; i++ {
+		point := from.Add(to.Sub(from).Scale(float32(i) / float32(steps)))
+		if !n.Walkable(point) {
+			return false
+		}
+	}
+	return true
+}
+
+// nearestWalkable searches outwards in growing rings for the walkable cell
+// closest to the given one.
+func (n *NavGrid) nearestWalkable(cell int) (int, bool) {
+	cx, cz := cell%n.Width, cell/n.Width
+	for radius := 0; radius < n.Width; radius++ {
+		for z := cz - radius; z <= cz+radius; z++ {
+			for x := cx - radius; x <= cx+radius; x++ {
+				onRing := x == cx-radius || x == cx+radius || z == cz-radius || z == cz+radius
+				if onRing && n.open(x, z) {
+					return z*n.Width + x, true
+				}
+			}
+		}
+	}
+	return 0, false
+}
+
+// open reports whether (x, z) is a walkable cell inside the grid.
+func (n *NavGrid) open(x, z int) bool {
+	return x >= 0 && x < n.Width && z >= 0 && z < n.Height && !n.blocked[z*n.Width+x]
+}
+
+// cell returns the grid coordinates containing a ground point, clamped to
+// the grid.
+func (n *NavGrid) cell(point Vec3) (int, int) {
+	x := int((point.X - n.OriginX) / n.CellSize)
+	z := int((point.Z - n.OriginZ) / n.CellSize)
+	return int(clamp(float32(x), 0, float32(n.Width-1))), int(clamp(float32(z), 0, float32(n.Height-1)))
+}
+
+func (n *NavGrid) index(point Vec3) int {
+	x, z := n.cell(point)
+	return z*n.Width + x
+}
+
+// center returns the ground point in the middle of a cell.
+func (n *NavGrid) center(x, z int) Vec3 {
+	return NewVec3(n.OriginX+(float32(x)+0.5)*n.CellSize, 0, n.OriginZ+(float32(z)+0.5)*n.CellSize)
+}
+
+// heuristic is the octile distance between two cells, in world units.
+func (n *NavGrid) heuristic(a, b int) float32 {
+	dx := abs32(float32(a%n.Width - b%n.Width))
+	dz := abs32(float32(a/n.Width - b/n.Width))
+	diagonal := float32(math.Min(float64(dx), float64(dz)))
+	return (dx + dz + (math.Sqrt2-2)*diagonal) * n.CellSize
+}
+
+var navSteps = []struct {
+	dx, dz int
+	cost   float32
+}{
+	{1, 0, NavCellSize}, {-1, 0, NavCellSize}, {0, 1, NavCellSize}, {0, -1, NavCellSize},
+	{1, 1, NavCellSize * math.Sqrt2}, {1, -1, NavCellSize * math.Sqrt2},
+	{-1, 1, NavCellSize * math.Sqrt2}, {-1, -1, NavCellSize * math.Sqrt2},
+}
+
+// navQueue is the A* open set, a min-heap on priority.
+type navQueue []navNode
+
+type navNode struct {
+	cell     int
+	priority float32
+}
+
+func (q navQueue) Len() int           { return len(q) }
+func (q navQueue) Less(i, j int) bool { return q[i].priority < q[j].priority }
+func (q navQueue) Swap(i, j int)      { q[i], q[j] = q[j], q[i] }
+func (q *navQueue) Push(x any)        { *q = append(*q, x.(navNode)) }
+func (q *navQueue) Pop() any {
+	old := *q
+	node := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return node
+}
@@ -0,0 +1,106 @@
+package sim
+
+import (
+	"math"
+	"testing"
+)
+
+// wall is a thin obstacle from one ground point to another along X or Z.
+func wall(x1, z1, x2, z2 float32) Obstacle {
+	return Obstacle{
+		Position: NewVec3((x1+x2)/2, 0, (z1+z2)/2),
+		Size:     NewVec3(max(x2-x1, 1), 3, max(z2-z1, 1)),
+		Type:     "building",
+	}
+}
+
+// walkableRoute reports whether every step along the waypoints, starting
+// from from, stays on walkable ground.
+func walkableRoute(n *NavGrid, from Vec3, path []Vec3) bool {
+	for _, to := range path {
+		steps := int(math.Sqrt(float64(distanceSquared(from, to)))/0.5) + 1
+		for i := 0; i <= steps; i++ {
+			if !n.Walkable(from.Add(to.Sub(from).Scale(float32(i) / float32(steps)))) {
+				return false
+			}
+		}
+		from = to
+	}
+	return true
+}
+
+func TestFindPath(t *testing.T) {
+	tests := []struct {
+		name      string
+		obstacles []Obstacle
+		from, to  Vec3
+		found     bool
+		waypoints int // Exact count, or -1 for more than one
+	}{
+		{
+			name:      "straight",
+			from:      NewVec3(-15, 0, -10),
+			to:        NewVec3(15, 0, -10),
+			found:     true,
+			waypoints: 1,
+		},
+		{
+			name:      "around an obstacle",
+			obstacles: []Obstacle{wall(0, -12, 0, 12)},
+			from:      NewVec3(-10, 0, 0),
+			to:        NewVec3(10, 0, 0),
+			found:     true,
+			waypoints: -1,
+		},
+		{
+			name: "unreachable goal",
+			obstacles: []Obstacle{
+				wall(5, 5, 15, 5), wall(5, 15, 15, 15),
+				wall(5, 5, 5, 15), wall(15, 5, 15, 15),
+			},
+			from:  NewVec3(-10, 0, -10),
+			to:    NewVec3(10, 0, 10),
+			found: false,
+		},
+		{
+			name:      "start inside an obstacle",
+			obstacles: []Obstacle{{Position: NewVec3(-10, 0, 0), Size: NewVec3(4, 3, 4), Type: "building"}},
+			from:      NewVec3(-10, 0, 0),
+			to:        NewVec3(10, 0, 0),
+			found:     true,
+			waypoints: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := NewNavGrid(&Terrain{Size: 20, Obstacles: tt.obstacles})
+			path, found := n.FindPath(tt.from, tt.to)
+			if found != tt.found {
+				t.Fatalf("found a path %v, want %v", found, tt.found)
+			}
+			if !found {
+				return
+			}
+
+			switch {
+			case tt.waypoints >= 0 && len(path) != tt.waypoints:
+				t.Errorf("got %d waypoints %v, want %d", len(path), path, tt.waypoints)
+			case tt.waypoints < 0 && len(path) < 2:
+				t.Errorf("got waypoints %v, want a detour", path)
+			}
+			if end := path[len(path)-1]; end != tt.to {
+				t.Errorf("path ends at %v, want %v", end, tt.to)
+			}
+			// A start inside an obstacle first leaves it the way it came in
+			from := tt.from
+			if !n.Walkable(from) {
+				from = path[0]
+				path = path[1:]
+			}
+			if !walkableRoute(n, from, path) {
+				t.Errorf("path %v crosses blocked ground", path)
+			}
+		})
+	}
+}
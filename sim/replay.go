@@ -0,0 +1,299 @@
+package sim
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"time"
+)
+
+const (
+	replayMagic   = "TNKR"
+	replayVersion = 7
+
+	// Limits on what a replay file may claim, so a corrupt one can't ask
+	// for gigabytes before it runs out. The config holds a whole map,
+	// heightmap included.
+	maxReplayConfig = 64 << 20
+	maxReplayLength = 6 * time.Hour
+)
+
+// Input flag bits in the replay encoding.
+const (
+	inputForward uint16 = 1 << iota
+	inputBackward
+	inputTurnLeft
+	inputTurnRight
+	inputTurretLeft
+	inputTurretRight
+	inputAimTurret
+	inputAiming
+	inputFire
+	inputGunUp
+	inputGunDown
+	inputHasAimPoint
+)
+
+// Replay is a recorded match: the config it was created from (seed, tank
+// classes and rules) and the player input for every tick. Stepping a new
+// Game with the same config through the inputs reproduces the match exactly.
+type Replay struct {
+	Config Config
+	Inputs []Input
+}
+
+// ReplayPlayer feeds a replay's inputs back one tick at a time.
+type ReplayPlayer struct {
+	Replay *Replay
+	Pos    int
+}
+
+// Next returns the input for the next tick, or false once the replay ends.
+func (p *ReplayPlayer) Next() (Input, bool) {
+	if p.Pos >= len(p.Replay.Inputs) {
+		return Input{}, false
+	}
+	in := p.Replay.Inputs[p.Pos]
+	p.Pos++
+	return in, true
+}
+
+// Done reports whether every recorded tick has been played.
+func (p *ReplayPlayer) Done() bool {
+	return p.Pos >= len(p.Replay.Inputs)
+}
+
+// LoadReplay reads a replay file from disk.
+func LoadReplay(path string) (*Replay, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ReadReplay(f)
+}
+
+// SaveReplay writes a replay file to disk.
+func SaveReplay(path string, r *Replay) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if err := WriteReplay(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// WriteReplay encodes r. Consecutive identical inputs are stored once with a
+// repeat count, and the turret angle and aim point are only stored for ticks
+// that use them. Replays longer than ReadReplay accepts are refused.
+func WriteReplay(w io.Writer, r *Replay) error {
+	config, err := json.Marshal(r.Config)
+	if err != nil {
+		return err
+	}
+	if len(config) > maxReplayConfig {
+		return fmt.Errorf("replay config is %d bytes, over the limit of %d", len(config), maxReplayConfig)
+	}
+	if len(r.Inputs) > Ticks(maxReplayLength) {
+		return fmt.Errorf("replay is %d ticks, over the limit of %d", len(r.Inputs), Ticks(maxReplayLength))
+	}
+
+	bw := bufio.NewWriter(w)
+	bw.WriteString(replayMagic)
+	bw.WriteByte(replayVersion)
+
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], uint64(len(config)))
+	bw.Write(buf[:n])
+	bw.Write(config)
+
+	n = binary.PutUvarint(buf[:], uint64(len(r.Inputs)))
+	bw.Write(buf[:n])
+
+	for i := 0; i < len(r.Inputs); {
+		in := r.Inputs[i]
+		run := 1
+		for i+run < len(r.Inputs) && r.Inputs[i+run] == in {
+			run++
+		}
+		i += run
+
+		n := binary.PutUvarint(buf[:], uint64(run))
+		bw.Write(buf[:n])
+		bw.Write(AppendInput(buf[:0], in))
+	}
+
+	return bw.Flush()
+}
+
+// AppendInput appends the compact encoding of one tick's input to b: a
+// flag word, followed by the turret angle and aim point only when used.
+func AppendInput(b []byte, in Input) []byte {
+	flags := encodeInputFlags(in)
+	b = binary.LittleEndian.AppendUint16(b, flags)
+	if flags&inputAimTurret != 0 {
+		b = binary.LittleEndian.AppendUint32(b, math.Float32bits(in.TurretAngle))
+	}
+	if flags&inputHasAimPoint != 0 {
+		for _, v := range []float32{in.AimPoint.X, in.AimPoint.Y, in.AimPoint.Z} {
+			b = binary.LittleEndian.AppendUint32(b, math.Float32bits(v))
+		}
+	}
+	return b
+}
+
+// DecodeInput reads an input written by AppendInput from the start of b
+// and returns it with the number of bytes it took.
+func DecodeInput(b []byte) (Input, int, error) {
+	r := bytes.NewReader(b)
+	in, err := readInput(r)
+	return in, len(b) - r.Len(), err
+}
+
+func readInput(r io.Reader) (Input, error) {
+	var buf [4]byte
+	if _, err := io.ReadFull(r, buf[:2]); err != nil {
+		return Input{}, err
+	}
+	in := decodeInputFlags(binary.LittleEndian.Uint16(buf[:2]))
+
+	if in.AimTurret {
+		if _, err := io.ReadFull(r, buf[:4]); err != nil {
+			return Input{}, err
+		}
+		in.TurretAngle = math.Float32frombits(binary.LittleEndian.Uint32(buf[:4]))
+	}
+	if in.HasAimPoint {
+		var point [3]float32
+		for j := range point {
+			if _, err := io.ReadFull(r, buf[:4]); err != nil {
+				return Input{}, err
+			}
+			point[j] = math.Float32frombits(binary.LittleEndian.Uint32(buf[:4]))
+		}
+		in.AimPoint = NewVec3(point[0], point[1], point[2])
+	}
+	return in, nil
+}
+
+// ReadReplay decodes a replay written by WriteReplay.
+func ReadReplay(r io.Reader) (*Replay, error) {
+	br := bufio.NewReader(r)
+
+	header := make([]byte, len(replayMagic)+1)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return nil, fmt.Errorf("replay header: %w", err)
+	}
+	if string(header[:len(replayMagic)]) != replayMagic {
+		return nil, errors.New("not a replay file")
+	}
+	// Older versions only stored the seed, which no longer pins down the
+	// tank classes and rules a match was played with
+	if version := header[len(replayMagic)]; version != replayVersion {
+		return nil, fmt.Errorf("unsupported replay version %d", version)
+	}
+
+	configLength, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, fmt.Errorf("replay config: %w", err)
+	}
+	if configLength > maxReplayConfig {
+		return nil, fmt.Errorf("replay config: %d bytes is over the limit of %d", configLength, maxReplayConfig)
+	}
+	// Read what is there rather than allocating what the file claims
+	config, err := io.ReadAll(io.LimitReader(br, int64(configLength)))
+	if err != nil {
+		return nil, fmt.Errorf("replay config: %w", err)
+	}
+	if uint64(len(config)) != configLength {
+		return nil, fmt.Errorf("replay config: %w", io.ErrUnexpectedEOF)
+	}
+	replay := &Replay{}
+	if err := json.Unmarshal(config, &replay.Config); err != nil {
+		return nil, fmt.Errorf("replay config: %w", err)
+	}
+
+	count, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, fmt.Errorf("replay length: %w", err)
+	}
+	if count > uint64(Ticks(maxReplayLength)) {
+		return nil, fmt.Errorf("replay length: %d ticks is over the limit of %d", count, Ticks(maxReplayLength))
+	}
+
+	for uint64(len(replay.Inputs)) < count {
+		run, err := binary.ReadUvarint(br)
+		if err != nil {
+			return nil, fmt.Errorf("replay tick %d: %w", len(replay.Inputs), err)
+		}
+		if run == 0 || run > count-uint64(len(replay.Inputs)) {
+			return nil, fmt.Errorf("replay tick %d: bad run length %d", len(replay.Inputs), run)
+		}
+
+		in, err := readInput(br)
+		if err != nil {
+			return nil, fmt.Errorf("replay tick %d: %w", len(replay.Inputs), err)
+		}
+
+		for ; run > 0; run-- {
+			replay.Inputs = append(replay.Inputs, in)
+		}
+	}
+
+	return replay, nil
+}
+
+func encodeInputFlags(in Input) uint16 {
+	var flags uint16
+	bits := []struct {
+		set  bool
+		flag uint16
+	}{
+		{in.Forward, inputForward},
+		{in.Backward, inputBackward},
+		{in.TurnLeft, inputTurnLeft},
+		{in.TurnRight, inputTurnRight},
+		{in.TurretLeft, inputTurretLeft},
+		{in.TurretRight, inputTurretRight},
+		{in.AimTurret, inputAimTurret},
+		{in.Aiming, inputAiming},
+		{in.Fire, inputFire},
+		{in.GunUp, inputGunUp},
+		{in.GunDown, inputGunDown},
+		{in.HasAimPoint, inputHasAimPoint},
+	}
+	for _, b := range bits {
+		if b.set {
+			flags |= b.flag
+		}
+	}
+	return flags
+}
+
+func decodeInputFlags(flags uint16) Input {
+	return Input{
+		Forward:     flags&inputForward != 0,
+		Backward:    flags&inputBackward != 0,
+		TurnLeft:    flags&inputTurnLeft != 0,
+		TurnRight:   flags&inputTurnRight != 0,
+		TurretLeft:  flags&inputTurretLeft != 0,
+		TurretRight: flags&inputTurretRight != 0,
+		AimTurret:   flags&inputAimTurret != 0,
+		Aiming:      flags&inputAiming != 0,
+		Fire:        flags&inputFire != 0,
+		GunUp:       flags&inputGunUp != 0,
+		GunDown:     flags&inputGunDown != 0,
+		HasAimPoint: flags&inputHasAimPoint != 0,
+	}
+}
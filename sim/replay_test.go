@@ -0,0 +1,105 @@
+package sim
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// scriptedInput drives the player's tank through a bit of everything the
+// replay encoding stores: held keys, turret aim, aim points and shots.
+func scriptedInput(tick int) Input {
+	in := Input{Forward: tick%300 < 200, Backward: tick%300 >= 250}
+	switch {
+	case tick%120 < 30:
+		in.TurnLeft = true
+	case tick%120 >= 90:
+		in.TurnRight = true
+	}
+	if tick%90 >= 45 {
+		in.AimTurret = true
+		in.TurretAngle = float32(tick%360) - 180
+	}
+	if tick%200 >= 150 {
+		in.Aiming = true
+		in.HasAimPoint = true
+		in.AimPoint = NewVec3(float32(tick%50), 1, float32(tick%70)-35)
+	}
+	in.Fire = tick%40 == 0
+	in.GunUp = tick%500 < 20
+	return in
+}
+
+func TestReplayRoundTrip(t *testing.T) {
+	cfg := testConfig(7, "7v7")
+	g := NewGame(cfg)
+	recording := g.Record()
+	for tick := 0; !g.Over(); tick++ {
+		if tick > Ticks(cfg.Countdown+cfg.TimeLimit) {
+			t.Fatalf("match still going at tick %d", g.Clock.Tick)
+		}
+		g.Step(scriptedInput(tick))
+	}
+
+	var buf bytes.Buffer
+	if err := WriteReplay(&buf, recording); err != nil {
+		t.Fatal(err)
+	}
+	size := buf.Len()
+	replay, err := ReadReplay(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(replay, recording) {
+		t.Fatal("replay read back differs from the one written")
+	}
+	t.Logf("%d ticks in %d bytes", len(replay.Inputs), size)
+
+	played := NewGame(replay.Config)
+	player := &ReplayPlayer{Replay: replay}
+	for in, ok := player.Next(); ok; in, ok = player.Next() {
+		played.Step(in)
+	}
+	if !reflect.DeepEqual(stateOf(played), stateOf(g)) {
+		t.Errorf("replay ended at tick %d in %v, the match at tick %d in %v",
+			played.Clock.Tick, played.Match.Phase, g.Clock.Tick, g.Match.Phase)
+	}
+}
+
+// replayHeader starts a replay file that claims a config of configLength
+// bytes; the rest is up to the test.
+func replayHeader(configLength uint64) []byte {
+	b := append([]byte(replayMagic), replayVersion)
+	return binary.AppendUvarint(b, configLength)
+}
+
+func TestReadReplayBounds(t *testing.T) {
+	config := []byte("{}")
+	withCount := func(count uint64, rest ...byte) []byte {
+		b := append(replayHeader(uint64(len(config))), config...)
+		return append(binary.AppendUvarint(b, count), rest...)
+	}
+	tests := []struct {
+		name string
+		file []byte
+		want string
+	}{
+		{"huge config", replayHeader(1 << 62), "over the limit"},
+		{"short config", append(replayHeader(1000), config...), "unexpected EOF"},
+		{"huge count", withCount(1 << 62), "over the limit"},
+		{"short inputs", withCount(uint64(Ticks(maxReplayLength))), "EOF"},
+		{"long run", withCount(10, 11, 0, 0), "bad run length"},
+		{"version", []byte(replayMagic + "\x01"), "unsupported replay version"},
+		{"magic", []byte("PNG\x89\x00"), "not a replay"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ReadReplay(bytes.NewReader(tt.file))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
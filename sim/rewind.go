@@ -0,0 +1,52 @@
+package sim
+
+// tankPose is as much of a tank's state as a shell needs to hit it.
+type tankPose struct {
+	Position       Vec3
+	Rotation       float32
+	TurretRotation float32
+}
+
+// poseFrame is where every tank stood at the end of one tick's movement,
+// in Game.Tanks order.
+type poseFrame struct {
+	tick  int
+	poses []tankPose
+}
+
+// recordPoses keeps this tick's tank poses for shells fired by tanks that
+// see the battlefield late. Only the last Config.MaxRewind worth are kept.
+func (g *Game) recordPoses(tanks []*Tank) {
+	if g.maxRewind <= 0 {
+		return
+	}
+	if g.history == nil {
+		g.history = make([]poseFrame, g.maxRewind+1)
+	}
+
+	frame := &g.history[g.Clock.Tick%len(g.history)]
+	frame.tick = g.Clock.Tick
+	frame.poses = frame.poses[:0]
+	for _, t := range tanks {
+		frame.poses = append(frame.poses, tankPose{t.Position, t.Rotation, t.TurretRotation})
+	}
+}
+
+// rewound returns a copy of the i-th tank posed where it stood ticks ago,
+// or as far back as the history goes.
+func (g *Game) rewound(t *Tank, i, ticks int) *Tank {
+	copied := *t
+	for ; ticks > 0; ticks-- {
+		tick := g.Clock.Tick - ticks
+		if tick < 0 {
+			continue
+		}
+		frame := g.history[tick%len(g.history)]
+		if frame.tick == tick && i < len(frame.poses) {
+			pose := frame.poses[i]
+			copied.Position, copied.Rotation, copied.TurretRotation = pose.Position, pose.Rotation, pose.TurretRotation
+			break
+		}
+	}
+	return &copied
+}
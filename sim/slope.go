@@ -0,0 +1,45 @@
+package sim
+
+import "math"
+
+// climb slows a tank driving uphill in proportion to the gradient, down to
+// half speed at the steepest slope it can manage, and holds it back from
+// anything steeper. from is where the tank started the tick.
+func (g *Game) climb(t *Tank, from Vec3) {
+	moved := distance2D(from, t.Position)
+	if moved == 0 {
+		return
+	}
+
+	rise := g.Terrain.HeightAt(t.Position.X, t.Position.Z) - g.Terrain.HeightAt(from.X, from.Z)
+	grade := rise / moved
+	if grade <= 0 {
+		return
+	}
+
+	limit := float32(math.Tan(float64(t.MaxSlope)))
+	factor := float32(0)
+	if grade < limit {
+		factor = 1 - 0.5*grade/limit
+	}
+	t.Position.X = from.X + (t.Position.X-from.X)*factor
+	t.Position.Z = from.Z + (t.Position.Z-from.Z)*factor
+}
+
+// settle rests a tank's hull on the ground under it, tilting it to follow
+// the slope.
+func (g *Game) settle(t *Tank) {
+	sin := float32(math.Sin(float64(t.Rotation)))
+	cos := float32(math.Cos(float64(t.Rotation)))
+	halfLength, halfWidth := t.HullLength/2, t.HullWidth/2
+
+	height := g.Terrain.HeightAt
+	front := height(t.Position.X+sin*halfLength, t.Position.Z+cos*halfLength)
+	back := height(t.Position.X-sin*halfLength, t.Position.Z-cos*halfLength)
+	right := height(t.Position.X+cos*halfWidth, t.Position.Z-sin*halfWidth)
+	left := height(t.Position.X-cos*halfWidth, t.Position.Z+sin*halfWidth)
+
+	t.Position.Y = (front+back+left+right)/4 + t.HullHeight/2
+	t.Pitch = float32(math.Atan2(float64(front-back), float64(t.HullLength)))
+	t.Roll = float32(math.Atan2(float64(right-left), float64(t.HullWidth)))
+}
@@ -0,0 +1,63 @@
+package sim
+
+import "time"
+
+// ProximitySpotRange is the distance within which tanks always spot each
+// other, even without a clear line of sight.
+const ProximitySpotRange = 10
+
+// updateSpotting works out which tanks their opponents can currently see.
+// A tank spotted by any opponent is visible to that whole side.
+func (g *Game) updateSpotting() {
+	tanks := g.Tanks()
+	for _, target := range tanks {
+		target.Spotted = false
+		if target.Health <= 0 {
+			continue
+		}
+		for _, observer := range tanks {
+			if observer.Health <= 0 || observer.Team == target.Team {
+				continue
+			}
+			if g.canSpot(observer, target) {
+				target.Spotted = true
+				break
+			}
+		}
+	}
+}
+
+// canSpot reports whether observer can see target: it has to be within the
+// observer's view range, shortened by haze and the target's camouflage,
+// with no terrain in between.
+func (g *Game) canSpot(observer, target *Tank) bool {
+	distance := distance2D(observer.Position, target.Position)
+	if distance <= ProximitySpotRange {
+		return true
+	}
+	if distance > observer.ViewRange*g.Environment.Visibility*(1-target.camouflage(g.Clock.Tick)) {
+		return false
+	}
+
+	_, blocked := g.Terrain.SegmentHit(observer.eye(), target.eye())
+	return !blocked
+}
+
+// camouflage returns how much of an observer's view range the tank hides
+// from right now. Moving halves it and firing gives the tank away entirely
+// for a few seconds.
+func (t *Tank) camouflage(now int) float32 {
+	if now-t.LastShot < Ticks(3*time.Second) {
+		return 0
+	}
+	if t.Velocity != (Vec3{}) {
+		return t.Camouflage / 2
+	}
+	return t.Camouflage
+}
+
+// eye returns the top of the turret, where the crew looks out and what an
+// observer needs to see.
+func (t *Tank) eye() Vec3 {
+	return NewVec3(t.Position.X, t.Position.Y+t.TurretOffset+t.TurretHeight/2, t.Position.Z)
+}
@@ -0,0 +1,305 @@
+package sim
+
+import (
+	"math"
+	"math/rand"
+)
+
+type Tank struct {
+	Class          string
+	Position       Vec3
+	Velocity       Vec3    // Movement during the last tick
+	Rotation       float32 // Body rotation
+	Pitch          float32 // Hull nose-up tilt from the ground slope
+	Roll           float32 // Hull tilt, positive with the local +X side raised
+	TurretRotation float32 // Turret rotation relative to body
+	TurretSpeed    float32 // Turret traverse in radians per tick
+	TurretArc      float32 // Turret traverse limit either side of ahead
+	GunElevation   float32 // Radians above the horizontal, stabilised against hull tilt
+	MaxElevation   float32
+	MaxDepression  float32
+	ElevationSpeed float32 // Radians per tick
+	MuzzleVelocity float32 // World units per tick
+	CannonLength   float32
+	Speed          float32
+	TurnSpeed      float32
+	MaxSlope       float32 // Steepest climbable slope in radians
+	Mass           float32 // Tonnes; heavier tanks shove lighter ones
+	Health         int
+	MaxHealth      int
+	Armor          Armor
+	Penetration    float32 // Shell penetration in millimetres
+	Damage         int     // Shell damage
+	Team           Team
+	IsPlayer       bool
+	LastShot       int // Clock tick of the last shot
+	ShotCooldown   int // Reload time in ticks
+	AimingCircle   AimingCircle
+	ViewRange      float32 // How far the crew can spot opponents
+	Camouflage     float32 // Fraction of an observer's view range it hides from
+	Spotted        bool    // Visible to the opposing side this tick
+
+	// Latency is how many ticks behind the present the crew sees the
+	// battlefield, as a network player does. Shells they fire are checked
+	// against where targets stood that long ago, up to Config.MaxRewind.
+	Latency int
+
+	// Controller drives the tank each tick. The player's tank has none
+	// unless Config.PlayerAI is set; it follows the Input passed to
+	// Game.Step.
+	Controller Controller
+
+	// Hull and turret box dimensions, matching what the frontend draws
+	HullWidth    float32
+	HullHeight   float32
+	HullLength   float32
+	TurretWidth  float32
+	TurretHeight float32
+	TurretLength float32
+	TurretOffset float32 // Height of the turret center above the hull center
+}
+
+// NewTank spawns a tank of the given class for a team at a ground position;
+// its hull is raised to rest on the ground there.
+func NewTank(class TankClass, position Vec3, team Team) *Tank {
+	shotCooldown := class.reloadTicks()
+	position.Y = GroundLevel + class.Hull.Height/2
+
+	turretArc := float32(math.Pi)
+	if class.Turret.Arc > 0 && class.Turret.Arc < 180 {
+		turretArc = radians(class.Turret.Arc)
+	}
+
+	return &Tank{
+		Class:          class.Name,
+		Position:       position,
+		Rotation:       0,
+		TurretRotation: 0,
+		TurretSpeed:    radians(perTick(class.Turret.Traverse)),
+		TurretArc:      turretArc,
+		MaxElevation:   radians(class.Gun.Elevation),
+		MaxDepression:  radians(class.Gun.Depression),
+		ElevationSpeed: radians(perTick(class.Gun.ElevationSpeed)),
+		MuzzleVelocity: perTick(class.Gun.MuzzleVelocity),
+		CannonLength:   class.Gun.Length,
+		Speed:          perTick(class.Speed),
+		TurnSpeed:      radians(perTick(class.TurnSpeed)),
+		MaxSlope:       radians(class.MaxSlope),
+		Mass:           class.Mass,
+		Health:         class.Health,
+		MaxHealth:      class.Health,
+		Armor:          class.Armor,
+		Penetration:    class.Gun.Penetration,
+		Damage:         class.Gun.Damage,
+		Team:           team,
+		LastShot:       -shotCooldown,
+		ShotCooldown:   shotCooldown,
+		AimingCircle:   NewAimingCircle(),
+		ViewRange:      class.ViewRange,
+		Camouflage:     class.Camouflage,
+		HullWidth:      class.Hull.Width,
+		HullHeight:     class.Hull.Height,
+		HullLength:     class.Hull.Length,
+		TurretWidth:    class.Turret.Width,
+		TurretHeight:   class.Turret.Height,
+		TurretLength:   class.Turret.Length,
+		TurretOffset:   class.Turret.Offset,
+	}
+}
+
+// Refit swaps a tank's class in place, keeping its position, heading and
+// controller, so everything holding the tank sees the change.
+func (g *Game) Refit(t *Tank, class TankClass) {
+	refitted := NewTank(orDefault(class), t.Position, t.Team)
+	refitted.Rotation = t.Rotation
+	refitted.IsPlayer = t.IsPlayer
+	refitted.Controller = t.Controller
+	*t = *refitted
+	g.settle(t)
+}
+
+// Update keeps the tank within a map spanning -size to size on X and Z.
+func (t *Tank) Update(size float32) {
+	t.Position.X = clamp(t.Position.X, -size, size)
+	t.Position.Z = clamp(t.Position.Z, -size, size)
+}
+
+// Footprint returns the hull's oriented outline on the ground plane.
+func (t *Tank) Footprint() Rect {
+	return Rect{
+		CenterX:    t.Position.X,
+		CenterZ:    t.Position.Z,
+		HalfWidth:  t.HullWidth / 2,
+		HalfLength: t.HullLength / 2,
+		Rotation:   t.Rotation,
+	}
+}
+
+func (t *Tank) MoveForward() {
+	t.Position.X += float32(math.Sin(float64(t.Rotation))) * t.Speed
+	t.Position.Z += float32(math.Cos(float64(t.Rotation))) * t.Speed
+}
+
+func (t *Tank) MoveBackward() {
+	t.Position.X -= float32(math.Sin(float64(t.Rotation))) * t.Speed * 0.5
+	t.Position.Z -= float32(math.Cos(float64(t.Rotation))) * t.Speed * 0.5
+}
+
+func (t *Tank) TurnLeft() {
+	t.Rotation -= t.TurnSpeed
+}
+
+func (t *Tank) TurnRight() {
+	t.Rotation += t.TurnSpeed
+}
+
+func (t *Tank) TurretLeft() {
+	t.SetTurretRotation(t.TurretRotation - t.TurretSpeed)
+}
+
+func (t *Tank) TurretRight() {
+	t.SetTurretRotation(t.TurretRotation + t.TurretSpeed)
+}
+
+// TraverseTurretTowards turns the turret one tick towards angle (relative to
+// the hull) at the turret's traverse speed, taking the shorter way round.
+func (t *Tank) TraverseTurretTowards(angle float32) {
+	diff := normalizeAngle(angle - t.TurretRotation)
+
+	// A limited turret can't cut across the back of the hull
+	if t.TurretArc < math.Pi {
+		diff = angle - t.TurretRotation
+	}
+
+	switch {
+	case diff > t.TurretSpeed:
+		diff = t.TurretSpeed
+	case diff < -t.TurretSpeed:
+		diff = -t.TurretSpeed
+	}
+	t.SetTurretRotation(normalizeAngle(t.TurretRotation + diff))
+}
+
+// Новый метод для установки поворота башни напрямую (для мыши)
+func (t *Tank) SetTurretRotation(angle float32) {
+	t.TurretRotation = angle
+
+	// Ограничиваем поворот башни (например, ±180 градусов)
+	maxTurretAngle := t.TurretArc
+	if t.TurretRotation > maxTurretAngle {
+		t.TurretRotation = maxTurretAngle
+	}
+	if t.TurretRotation < -maxTurretAngle {
+		t.TurretRotation = -maxTurretAngle
+	}
+}
+
+// Reloaded reports whether the gun can fire at the given clock tick.
+func (t *Tank) Reloaded(now int) bool {
+	return now-t.LastShot >= t.ShotCooldown
+}
+
+// ElevateTowards moves the gun elevation one tick towards the given angle,
+// within the gun's elevation and depression limits.
+func (t *Tank) ElevateTowards(angle float32) {
+	if angle > t.MaxElevation {
+		angle = t.MaxElevation
+	}
+	if angle < -t.MaxDepression {
+		angle = -t.MaxDepression
+	}
+
+	switch {
+	case angle > t.GunElevation+t.ElevationSpeed:
+		t.GunElevation += t.ElevationSpeed
+	case angle < t.GunElevation-t.ElevationSpeed:
+		t.GunElevation -= t.ElevationSpeed
+	default:
+		t.GunElevation = angle
+	}
+}
+
+// AimAt elevates the gun towards the arc that lands a shell on target.
+func (t *Tank) AimAt(target Vec3) {
+	// Shells leave from the muzzle, a cannon length closer to the target
+	from := t.gunPivot()
+	dx, dz := target.X-from.X, target.Z-from.Z
+	if distance := float32(math.Hypot(float64(dx), float64(dz))); distance > t.CannonLength {
+		from.X += dx / distance * t.CannonLength
+		from.Z += dz / distance * t.CannonLength
+	}
+
+	t.ElevateTowards(ElevationTo(from, target, t.MuzzleVelocity))
+}
+
+func (t *Tank) Shoot(now int) *Bullet {
+	if !t.Reloaded(now) {
+		return nil
+	}
+
+	t.LastShot = now
+
+	return t.newShell(t.Rotation + t.TurretRotation)
+}
+
+// Новый метод стрельбы с учетом точности
+func (t *Tank) ShootWithAccuracy(accuracyRadius float32, now int, rng *rand.Rand) *Bullet {
+	if !t.Reloaded(now) {
+		return nil
+	}
+
+	t.LastShot = now
+
+	// Добавляем разброс в зависимости от точности
+	// Чем больше accuracyRadius, тем больше разброс
+	spreadFactor := accuracyRadius / 100.0                    // Нормализуем разброс
+	angleSpread := (rng.Float32() - 0.5) * spreadFactor * 0.2 // ±10% от разброса
+
+	finalAngle := t.Rotation + t.TurretRotation + angleSpread
+
+	return t.newShell(finalAngle)
+}
+
+// newShell loads the tank's gun stats into a shell fired along angle.
+func (t *Tank) newShell(angle float32) *Bullet {
+	bullet := NewBullet(t.muzzlePosition(), angle, t.GunElevation, t.MuzzleVelocity, t.Team)
+	bullet.Shooter = t
+	bullet.Penetration = t.Penetration
+	bullet.Damage = t.Damage
+	return bullet
+}
+
+// gunPivot returns the point the gun elevates around.
+func (t *Tank) gunPivot() Vec3 {
+	return NewVec3(t.Position.X, t.Position.Y+t.TurretOffset+0.3, t.Position.Z)
+}
+
+// muzzlePosition returns the bullet spawn point at the end of the cannon.
+func (t *Tank) muzzlePosition() Vec3 {
+	totalRotation := t.Rotation + t.TurretRotation
+	horizontal := float32(math.Cos(float64(t.GunElevation))) * t.CannonLength
+
+	return t.gunPivot().Add(NewVec3(
+		float32(math.Sin(float64(totalRotation)))*horizontal,
+		float32(math.Sin(float64(t.GunElevation)))*t.CannonLength,
+		float32(math.Cos(float64(totalRotation)))*horizontal,
+	))
+}
+
+func (t *Tank) TakeDamage(damage int) {
+	t.Health -= damage
+	if t.Health < 0 {
+		t.Health = 0
+	}
+}
+
+// normalizeAngle wraps an angle into [-π, π].
+func normalizeAngle(angle float32) float32 {
+	for angle > math.Pi {
+		angle -= 2 * math.Pi
+	}
+	for angle < -math.Pi {
+		angle += 2 * math.Pi
+	}
+	return angle
+}
@@ -0,0 +1,193 @@
+package sim
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// TankClass describes a type of tank. Classes are loaded from JSON files so
+// balance can be tuned without recompiling; values use designer-friendly
+// units (seconds, degrees, units per second) and are converted to per-tick
+// values when a tank is spawned.
+type TankClass struct {
+	Name string `json:"name"`
+	Role string `json:"role"` // light, medium, heavy, tank_destroyer or artillery
+
+	Hull struct {
+		Width  float32 `json:"width"`
+		Height float32 `json:"height"`
+		Length float32 `json:"length"`
+	} `json:"hull"`
+
+	Turret struct {
+		Width    float32 `json:"width"`
+		Height   float32 `json:"height"`
+		Length   float32 `json:"length"`
+		Offset   float32 `json:"offset"`   // Height of its center above the hull center
+		Traverse float32 `json:"traverse"` // Degrees per second
+		Arc      float32 `json:"arc"`      // Degrees either side of straight ahead; 0 is unlimited
+	} `json:"turret"`
+
+	Speed     float32 `json:"speed"`      // Units per second
+	TurnSpeed float32 `json:"turn_speed"` // Degrees per second
+	MaxSlope  float32 `json:"max_slope"`  // Steepest climbable slope in degrees
+	Mass      float32 `json:"mass"`       // Tonnes
+	Health    int     `json:"health"`
+	Armor     Armor   `json:"armor"`
+
+	ViewRange  float32 `json:"view_range"` // Units
+	Camouflage float32 `json:"camouflage"` // 0 (none) to 1 (invisible)
+
+	Gun struct {
+		Damage         int     `json:"damage"`
+		Penetration    float32 `json:"penetration"`     // Millimetres
+		Reload         float32 `json:"reload"`          // Seconds
+		MuzzleVelocity float32 `json:"muzzle_velocity"` // Units per second
+		Elevation      float32 `json:"elevation"`       // Degrees
+		Depression     float32 `json:"depression"`      // Degrees
+		ElevationSpeed float32 `json:"elevation_speed"` // Degrees per second
+		Length         float32 `json:"length"`
+	} `json:"gun"`
+}
+
+// DefaultTankClass is the medium tank every match used before classes were
+// data driven. It is used when no class is given.
+func DefaultTankClass() TankClass {
+	var c TankClass
+	c.Name = "medium"
+	c.Role = "medium"
+
+	c.Hull.Width = 3
+	c.Hull.Height = 1
+	c.Hull.Length = 4
+
+	c.Turret.Width = 2
+	c.Turret.Height = 0.8
+	c.Turret.Length = 2.5
+	c.Turret.Offset = 0.7
+	c.Turret.Traverse = 82
+
+	c.Speed = 12
+	c.TurnSpeed = 103
+	c.MaxSlope = 30
+	c.Mass = 30
+	c.Health = 100
+	c.Armor = Armor{Front: 100, Side: 60, Rear: 40, Turret: 90}
+	c.ViewRange = 70
+	c.Camouflage = 0.25
+
+	c.Gun.Damage = 25
+	c.Gun.Penetration = 120
+	c.Gun.Reload = 0.8
+	c.Gun.MuzzleVelocity = 48
+	c.Gun.Elevation = 20
+	c.Gun.Depression = 8
+	c.Gun.ElevationSpeed = 69
+	c.Gun.Length = 3
+
+	return c
+}
+
+// LoadTankClass reads a single class definition.
+func LoadTankClass(path string) (TankClass, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return TankClass{}, err
+	}
+
+	var class TankClass
+	if err := json.Unmarshal(data, &class); err != nil {
+		return TankClass{}, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := class.validate(); err != nil {
+		return TankClass{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return class, nil
+}
+
+// LoadTankClasses reads every *.json class in dir, keyed by name.
+func LoadTankClasses(dir string) (map[string]TankClass, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	classes := make(map[string]TankClass, len(paths))
+	for _, path := range paths {
+		class, err := LoadTankClass(path)
+		if err != nil {
+			return nil, err
+		}
+		if _, dup := classes[class.Name]; dup {
+			return nil, fmt.Errorf("%s: duplicate tank class %q", path, class.Name)
+		}
+		classes[class.Name] = class
+	}
+	return classes, nil
+}
+
+// FindTankClass looks up a tank class by name. The built-in medium tank is
+// always available, even without class files.
+func FindTankClass(classes map[string]TankClass, name string) (TankClass, error) {
+	if class, ok := classes[name]; ok {
+		return class, nil
+	}
+	if name == DefaultTankClass().Name {
+		return DefaultTankClass(), nil
+	}
+	return TankClass{}, fmt.Errorf("unknown tank class %q", name)
+}
+
+// FindTankClasses looks up a comma-separated list of tank class names.
+func FindTankClasses(classes map[string]TankClass, names string) ([]TankClass, error) {
+	var found []TankClass
+	for _, name := range strings.Split(names, ",") {
+		class, err := FindTankClass(classes, strings.TrimSpace(name))
+		if err != nil {
+			return nil, err
+		}
+		found = append(found, class)
+	}
+	return found, nil
+}
+
+func (c TankClass) validate() error {
+	switch {
+	case c.Name == "":
+		return fmt.Errorf("tank class has no name")
+	case c.Hull.Width <= 0 || c.Hull.Height <= 0 || c.Hull.Length <= 0:
+		return fmt.Errorf("tank class %q: hull dimensions must be positive", c.Name)
+	case c.Health <= 0:
+		return fmt.Errorf("tank class %q: health must be positive", c.Name)
+	case c.Mass <= 0:
+		return fmt.Errorf("tank class %q: mass must be positive", c.Name)
+	case c.MaxSlope <= 0 || c.MaxSlope >= 90:
+		return fmt.Errorf("tank class %q: max slope must be between 0 and 90 degrees", c.Name)
+	case c.Camouflage < 0 || c.Camouflage >= 1:
+		return fmt.Errorf("tank class %q: camouflage must be at least 0 and below 1", c.Name)
+	case c.Gun.MuzzleVelocity <= 0 || c.Gun.Reload <= 0:
+		return fmt.Errorf("tank class %q: gun needs a muzzle velocity and reload", c.Name)
+	}
+	return nil
+}
+
+// perTick converts a per-second rate to a per-tick one.
+func perTick(perSecond float32) float32 {
+	return perSecond / TickRate
+}
+
+func radians(degrees float32) float32 {
+	return degrees * math.Pi / 180
+}
+
+// reloadTicks converts the gun's reload time to ticks.
+func (c TankClass) reloadTicks() int {
+	return Ticks(time.Duration(c.Gun.Reload * float32(time.Second)))
+}
@@ -0,0 +1,113 @@
+package sim
+
+import (
+	"math"
+	"math/rand"
+)
+
+// Team identifies a side in a battle. Tanks on the same team are allies.
+type Team int
+
+const (
+	PlayerTeam Team = iota // The player and any friendly AI tanks
+	EnemyTeam
+)
+
+func (t Team) String() string {
+	switch t {
+	case PlayerTeam:
+		return "player"
+	case EnemyTeam:
+		return "enemy"
+	}
+	return "unknown"
+}
+
+// Opponent returns the team fighting t.
+func (t Team) Opponent() Team {
+	if t == PlayerTeam {
+		return EnemyTeam
+	}
+	return PlayerTeam
+}
+
+// BattleMode describes how a match is set up.
+type BattleMode struct {
+	Name string
+	// TeamSize is the number of tanks per side, the player included. Zero
+	// is the classic skirmish of the player alone against three enemies.
+	TeamSize int
+}
+
+// BattleModes are the built-in match types.
+var BattleModes = map[string]BattleMode{
+	"skirmish": {Name: "skirmish"},
+	"7v7":      {Name: "7v7", TeamSize: 7},
+	"15v15":    {Name: "15v15", TeamSize: 15},
+}
+
+// battleMode returns the named mode, defaulting to skirmish.
+func battleMode(name string) BattleMode {
+	if mode, ok := BattleModes[name]; ok {
+		return mode
+	}
+	return BattleModes["skirmish"]
+}
+
+// teamSpawns lines a team up in rows across its end of the map, facing the
+// other end.
+func teamSpawns(team Team, size int) []Vec3 {
+	const perRow, spacing = 8, 8
+
+	spawns := make([]Vec3, 0, size)
+	for i := 0; i < size; i++ {
+		row, column := i/perRow, i%perRow
+		inRow := perRow
+		if remaining := size - row*perRow; remaining < perRow {
+			inRow = remaining
+		}
+
+		x := (float32(column) - float32(inRow-1)/2) * spacing
+		z := -(MapSize - 12 - float32(row)*spacing)
+		if team != PlayerTeam {
+			z = -z
+		}
+		spawns = append(spawns, NewVec3(x, 0, z))
+	}
+	return spawns
+}
+
+// teamHeading returns the hull rotation that faces a team's spawn towards
+// the enemy.
+func teamHeading(team Team) float32 {
+	if team == PlayerTeam {
+		return 0
+	}
+	return math.Pi
+}
+
+// advanceRoute plans waypoints from a spawn point across the map towards
+// an objective, weaving from side to side.
+func advanceRoute(rng *rand.Rand, spawn, objective Vec3, size float32) []Vec3 {
+	waypoints := make([]Vec3, 0, 4)
+	for i := 1; i <= 4; i++ {
+		progress := float32(i) / 4
+		waypoints = append(waypoints, NewVec3(
+			clamp(spawn.X+(objective.X-spawn.X)*progress+(rng.Float32()-0.5)*40, -size+5, size-5),
+			0,
+			clamp(spawn.Z+(objective.Z-spawn.Z)*progress, -size+5, size-5),
+		))
+	}
+	return waypoints
+}
+
+// Alive returns the number of living tanks on a team.
+func (g *Game) Alive(team Team) int {
+	alive := 0
+	for _, t := range g.Tanks() {
+		if t.Team == team && t.Health > 0 {
+			alive++
+		}
+	}
+	return alive
+}
@@ -0,0 +1,219 @@
+package sim
+
+import (
+	"math"
+	"math/rand"
+)
+
+type Obstacle struct {
+	Position Vec3
+	Size     Vec3
+	Rotation float32 // Around Y, like Tank.Rotation
+	Type     string
+	Health   int // Structural hit points left; see ObstacleTypes
+}
+
+// Footprint returns the obstacle's base on the ground plane.
+func (o Obstacle) Footprint() Rect {
+	return Rect{
+		CenterX:    o.Position.X,
+		CenterZ:    o.Position.Z,
+		HalfWidth:  o.Size.X / 2,
+		HalfLength: o.Size.Z / 2,
+		Rotation:   o.Rotation,
+	}
+}
+
+// SegmentHit returns where the segment from→to first enters the obstacle,
+// as a fraction of its length. Only tree trunks block, not their crowns.
+func (o Obstacle) SegmentHit(from, to Vec3) (float32, bool) {
+	return o.Footprint().SegmentHit(from, to, o.Position.Y, o.Position.Y+o.Size.Y)
+}
+
+type Terrain struct {
+	// Size is half the width of the square battlefield, which spans -Size
+	// to Size along X and Z.
+	Size      float32
+	Obstacles []Obstacle
+	Ground    *Heightmap // Flat at GroundLevel when nil
+
+	// Debris is what destroyed obstacles leave lying around, such as fallen
+	// trees. It is only for show: tanks drive over it and shells and sight
+	// pass through.
+	Debris []Obstacle
+}
+
+// NewTerrain scatters buildings and trees over the ground using rng, so the
+// same seed always produces the same map.
+func NewTerrain(rng *rand.Rand, ground *Heightmap) *Terrain {
+	obstacles := make([]Obstacle, 0)
+
+	// Generate random obstacles (buildings, rocks, trees)
+	for i := 0; i < 30; i++ {
+		obstacle := Obstacle{
+			Position: NewVec3(
+				(rng.Float32()-0.5)*MapSize*1.5,
+				0,
+				(rng.Float32()-0.5)*MapSize*1.5,
+			),
+			Size: NewVec3(
+				2+rng.Float32()*4,
+				1+rng.Float32()*3,
+				2+rng.Float32()*4,
+			),
+			Type: "building",
+		}
+		obstacles = append(obstacles, obstacle)
+	}
+
+	// Add some trees
+	for i := 0; i < 50; i++ {
+		obstacle := Obstacle{
+			Position: NewVec3(
+				(rng.Float32()-0.5)*MapSize*1.8,
+				0,
+				(rng.Float32()-0.5)*MapSize*1.8,
+			),
+			Size: NewVec3(
+				0.5+rng.Float32(),
+				3+rng.Float32()*2,
+				0.5+rng.Float32(),
+			),
+			Type: "tree",
+		}
+		obstacles = append(obstacles, obstacle)
+	}
+
+	t := &Terrain{
+		Size:      MapSize,
+		Obstacles: obstacles,
+		Ground:    ground,
+	}
+	t.prepareObstacles()
+
+	return t
+}
+
+// prepareObstacles sinks each obstacle into the ground so it doesn't float
+// off slopes, and gives it its type's full health.
+func (t *Terrain) prepareObstacles() {
+	for i := range t.Obstacles {
+		obstacle := &t.Obstacles[i]
+		obstacle.Position.Y = t.lowestUnder(obstacle.Footprint())
+		obstacle.Health = ObstacleTypes[obstacle.Type].Health
+	}
+}
+
+// Contains reports whether a ground point lies on the battlefield.
+func (t *Terrain) Contains(p Vec3) bool {
+	return p.X >= -t.Size && p.X <= t.Size && p.Z >= -t.Size && p.Z <= t.Size
+}
+
+// HeightAt returns the height of the ground at a world position.
+func (t *Terrain) HeightAt(x, z float32) float32 {
+	if t.Ground == nil {
+		return GroundLevel
+	}
+	spacing := t.groundSpacing()
+	return GroundLevel + t.Ground.HeightAt((x+t.Size)/spacing, (z+t.Size)/spacing)
+}
+
+// groundSpacing returns the world distance between heightmap samples.
+func (t *Terrain) groundSpacing() float32 {
+	return 2 * t.Size / float32(t.Ground.Size-1)
+}
+
+// Slope returns the steepest gradient of the ground at a world position, as
+// an angle in radians.
+func (t *Terrain) Slope(x, z float32) float32 {
+	const d = 0.5
+	dx := (t.HeightAt(x+d, z) - t.HeightAt(x-d, z)) / (2 * d)
+	dz := (t.HeightAt(x, z+d) - t.HeightAt(x, z-d)) / (2 * d)
+	return float32(math.Atan(math.Hypot(float64(dx), float64(dz))))
+}
+
+// lowestUnder returns the lowest ground height at the corners and center of
+// a footprint.
+func (t *Terrain) lowestUnder(r Rect) float32 {
+	lowest := t.HeightAt(r.CenterX, r.CenterZ)
+	for _, corner := range [][2]float32{{-1, -1}, {-1, 1}, {1, -1}, {1, 1}} {
+		x := r.CenterX + corner[0]*r.HalfWidth
+		z := r.CenterZ + corner[1]*r.HalfLength
+		if height := t.HeightAt(x, z); height < lowest {
+			lowest = height
+		}
+	}
+	return lowest
+}
+
+// SegmentHit finds the first obstacle or patch of ground crossed by the
+// segment from→to and returns the point of impact. Hills block it like any
+// obstacle, so a hull behind a crest is safe from shells and unseen.
+func (t *Terrain) SegmentHit(from, to Vec3) (Vec3, bool) {
+	point, _, hit := t.segmentHit(from, to)
+	return point, hit
+}
+
+// segmentHit is SegmentHit that also returns the index of the obstacle
+// struck, or -1 for the ground.
+func (t *Terrain) segmentHit(from, to Vec3) (Vec3, int, bool) {
+	nearest, struck := float32(2), -1
+	if fraction, hit := t.groundHit(from, to); hit {
+		nearest = fraction
+	}
+	for i, obstacle := range t.Obstacles {
+		if fraction, hit := obstacle.SegmentHit(from, to); hit && fraction < nearest {
+			nearest, struck = fraction, i
+		}
+	}
+	if nearest > 1 {
+		return Vec3{}, -1, false
+	}
+
+	return NewVec3(
+		from.X+(to.X-from.X)*nearest,
+		from.Y+(to.Y-from.Y)*nearest,
+		from.Z+(to.Z-from.Z)*nearest,
+	), struck, true
+}
+
+// groundHit returns where the segment from→to first dips below the ground,
+// as a fraction of its length. It samples at half the heightmap spacing and
+// then narrows down the crossing.
+func (t *Terrain) groundHit(from, to Vec3) (float32, bool) {
+	below := func(fraction float32) bool {
+		p := from.Add(to.Sub(from).Scale(fraction))
+		return p.Y < t.HeightAt(p.X, p.Z)
+	}
+	if below(0) {
+		return 0, true
+	}
+
+	step := float32(1)
+	if t.Ground != nil {
+		step = t.groundSpacing() / 2
+	}
+	steps := int(distance2D(from, to)/step) + 1
+
+	previous := float32(0)
+	for i := 1; i <= steps; i++ {
+		fraction := float32(i) / float32(steps)
+		if !below(fraction) {
+			previous = fraction
+			continue
+		}
+
+		// Bisect between the last point above ground and this one
+		low, high := previous, fraction
+		for j := 0; j < 8; j++ {
+			mid := (low + high) / 2
+			if below(mid) {
+				high = mid
+			} else {
+				low = mid
+			}
+		}
+		return high, true
+	}
+	return 0, false
+}
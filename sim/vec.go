@@ -0,0 +1,38 @@
+package sim
+
+// Vec3 is a point or direction in world space. It mirrors rl.Vector3 so the
+// simulation can run without raylib.
+type Vec3 struct {
+	X, Y, Z float32
+}
+
+func NewVec3(x, y, z float32) Vec3 {
+	return Vec3{X: x, Y: y, Z: z}
+}
+
+func (v Vec3) Add(o Vec3) Vec3 {
+	return Vec3{X: v.X + o.X, Y: v.Y + o.Y, Z: v.Z + o.Z}
+}
+
+func (v Vec3) Sub(o Vec3) Vec3 {
+	return Vec3{X: v.X - o.X, Y: v.Y - o.Y, Z: v.Z - o.Z}
+}
+
+func (v Vec3) Scale(s float32) Vec3 {
+	return Vec3{X: v.X * s, Y: v.Y * s, Z: v.Z * s}
+}
+
+func distanceSquared(a, b Vec3) float32 {
+	d := a.Sub(b)
+	return d.X*d.X + d.Y*d.Y + d.Z*d.Z
+}
+
+func clamp(v, min, max float32) float32 {
+	if v < min {
+		return min
+	}
+	if v > max {
+		return max
+	}
+	return v
+}